@@ -0,0 +1,37 @@
+package main
+
+import (
+	"github.com/NodyHub/hashref/pkg/hashref"
+	"github.com/NodyHub/hashref/pkg/output"
+	"github.com/NodyHub/hashref/pkg/policy"
+)
+
+// runCheck verifies the files of a checksum file and looks up each
+// expected digest on the server
+func runCheck(hc *hashref.HashrefClient, pol *policy.Policy, out output.Writer, status *exitStatus) {
+	entries, err := hashref.ParseChecksumFile(CLI.Check)
+	if err != nil {
+		usageError("%v", err)
+	}
+	for _, result := range hashref.VerifyChecksums(entries) {
+		if result.Status != hashref.StatusUnchanged {
+			status.Update(ExitDrift)
+		}
+
+		// Lookup the expected digest on the server
+		success, meta := hc.GetRemoteData(hashref.File, result.Input, result.Hash)
+		remote := hashref.NewLookupResult(hashref.File, result.Input, result.Hash, success, meta)
+		status.UpdateResult(remote)
+		applyPolicy(pol, &remote, status)
+		result.Violations = remote.Violations
+		result.Meta = remote.Meta
+		if result.Meta == nil {
+			result.Meta = map[string]interface{}{}
+		}
+		result.Meta["remote"] = remote.Status
+		if result.Error == "" {
+			result.Error = remote.Error
+		}
+		writeResult(out, result)
+	}
+}
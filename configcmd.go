@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/NodyHub/hashref/pkg/hashref"
+)
+
+type ConfigCmd struct {
+	Use      ConfigUseCmd      `cmd:"" help:"Make the profile the current profile of the config"`
+	List     ConfigListCmd     `cmd:"" help:"List the profiles of the config, the current one is marked with *"`
+	Show     ConfigShowCmd     `cmd:"" help:"Show the effective configuration with masked credentials"`
+	Get      ConfigGetCmd      `cmd:"" help:"Print the effective value of a config key"`
+	Set      ConfigSetCmd      `cmd:"" help:"Set a config key in the config file (in the --profile if provided)"`
+	Unset    ConfigUnsetCmd    `cmd:"" help:"Remove a config key from the config file (from the --profile if provided)"`
+	Validate ConfigValidateCmd `cmd:"" help:"Validate all config layers and the effective configuration"`
+}
+
+type ConfigUseCmd struct {
+	Name string `arg:"" help:"Name of the profile"`
+}
+
+type ConfigListCmd struct{}
+
+type ConfigShowCmd struct {
+	Name   string `arg:"" optional:"" help:"Name of the profile (default: --profile, HASHREF_PROFILE or the current profile)"`
+	Origin bool   `optional:"" help:"Show which layer (default, config file, profile, env, flag) set each value"`
+}
+
+type ConfigGetCmd struct {
+	Key string `arg:"" help:"Config key, KEY.entry for an entry of a map"`
+}
+
+type ConfigSetCmd struct {
+	Key   string `arg:"" help:"Config key, KEY.entry for an entry of a map"`
+	Value string `arg:"" help:"Value, parsed like the environment variable of the key"`
+}
+
+type ConfigUnsetCmd struct {
+	Key string `arg:"" help:"Config key, KEY.entry for an entry of a map"`
+}
+
+type ConfigValidateCmd struct{}
+
+// runConfig inspects and edits the config. Errors of loading the config
+// are reported by every command except set and unset, they can repair
+// the config file.
+func runConfig(cfg hashref.Config, loadErr error, command string, outFile *os.File) {
+	path := hashref.UserConfigPath(CLI.Config)
+	if loadErr != nil && command != "set" && command != "unset" {
+		if command == "validate" {
+			fmt.Fprintf(outFile, "%v\n", loadErr)
+			os.Exit(ExitUsage)
+		}
+		usageError("%v", loadErr)
+	}
+	switch command {
+	case "use":
+		if _, ok := cfg.Profiles[CLI.ConfigCmd.Use.Name]; !ok {
+			usageError("unknown profile %q, available: %v", CLI.ConfigCmd.Use.Name, cfg.ProfileNames())
+		}
+		editConfigFile(path, func(fields map[string]interface{}) error {
+			fields[hashref.ProfileEnv] = CLI.ConfigCmd.Use.Name
+			return nil
+		})
+		fmt.Fprintf(outFile, "Switched to profile %v :)\n", CLI.ConfigCmd.Use.Name)
+	case "list":
+		current := CLI.Profile
+		if current == "" {
+			current = os.Getenv(hashref.ProfileEnv)
+		}
+		if current == "" {
+			current = cfg.Profile
+		}
+		for _, name := range cfg.ProfileNames() {
+			marker := " "
+			if name == current {
+				marker = "*"
+			}
+			fmt.Fprintf(outFile, "%v %v\n", marker, name)
+		}
+	case "show":
+		name := CLI.ConfigCmd.Show.Name
+		if name == "" {
+			name = CLI.Profile
+		}
+		if err := resolveConfig(&cfg, name); err != nil {
+			usageError("%v", err)
+		}
+		cfg.Profiles = nil
+		if CLI.ConfigCmd.Show.Origin {
+			showOrigins(cfg, outFile)
+			return
+		}
+		b, err := json.MarshalIndent(cfg.Redacted(), "", "    ")
+		if err != nil {
+			usageError("%v", err)
+		}
+		fmt.Fprintf(outFile, "%v\n", string(b))
+	case "get":
+		if err := resolveConfig(&cfg, CLI.Profile); err != nil {
+			usageError("%v", err)
+		}
+		base, entry, isEntry := strings.Cut(CLI.ConfigCmd.Get.Key, ".")
+		value, ok := cfg.Fields()[base]
+		if isEntry {
+			m, _ := value.(map[string]interface{})
+			value, ok = m[entry]
+		}
+		if !ok {
+			usageError("%v is not set", CLI.ConfigCmd.Get.Key)
+		}
+		if s, isString := value.(string); isString {
+			fmt.Fprintf(outFile, "%v\n", s)
+			return
+		}
+		b, _ := json.Marshal(value)
+		fmt.Fprintf(outFile, "%s\n", b)
+	case "set":
+		editConfigFile(path, func(fields map[string]interface{}) error {
+			return hashref.SetConfigValue(fields, CLI.Profile, CLI.ConfigCmd.Set.Key, CLI.ConfigCmd.Set.Value)
+		})
+		fmt.Fprintf(outFile, "%v set in %v :)\n", CLI.ConfigCmd.Set.Key, path)
+	case "unset":
+		editConfigFile(path, func(fields map[string]interface{}) error {
+			return hashref.UnsetConfigValue(fields, CLI.Profile, CLI.ConfigCmd.Unset.Key)
+		})
+		fmt.Fprintf(outFile, "%v removed from %v :)\n", CLI.ConfigCmd.Unset.Key, path)
+	case "validate":
+		if err := resolveConfig(&cfg, CLI.Profile); err != nil {
+			fmt.Fprintf(outFile, "%v\n", err)
+			os.Exit(ExitUsage)
+		}
+		if err := cfg.Validate(); err != nil {
+			fmt.Fprintf(outFile, "%v\n", err)
+			os.Exit(ExitUsage)
+		}
+		for _, layer := range hashref.ConfigLayers(CLI.Config) {
+			fmt.Fprintf(outFile, "%v is valid :)\n", layer)
+		}
+		fmt.Fprintf(outFile, "Effective config is valid :)\n")
+	}
+}
+
+// editConfigFile applies the edit to the config file and writes it back
+// if the result is still a valid config. Invalid config files can be
+// repaired step by step, the remaining problems are reported.
+func editConfigFile(path string, edit func(map[string]interface{}) error) {
+	fields, err := hashref.LoadConfigFile(path)
+	if err != nil {
+		usageError("%v", err)
+	}
+	wasValid := validateFields(fields) == nil
+	if err := edit(fields); err != nil {
+		usageError("%v", err)
+	}
+	if err := validateFields(fields); err != nil {
+		if wasValid {
+			usageError("%v", err)
+		}
+		fmt.Fprintf(os.Stderr, "hashref: warning: %v\n", err)
+	}
+	if err := hashref.WriteConfigFile(path, fields); err != nil {
+		usageError("%v", err)
+	}
+}
+
+// validateFields checks config file content on top of the defaults
+func validateFields(fields map[string]interface{}) error {
+	cfg, err := hashref.ConfigFromFields(fields)
+	if err != nil {
+		return err
+	}
+	return cfg.Validate()
+}
+
+// showOrigins prints every config value with the layer that set it
+func showOrigins(cfg hashref.Config, outFile *os.File) {
+	fields := cfg.Redacted().Fields()
+	tw := tabwriter.NewWriter(outFile, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "KEY\tVALUE\tORIGIN")
+	for _, key := range cfg.FieldNames() {
+		b, _ := json.Marshal(fields[key])
+		fmt.Fprintf(tw, "%v\t%s\t%v\n", key, b, cfg.Origin(key))
+	}
+	tw.Flush()
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/NodyHub/hashref/pkg/hashref"
+	"golang.org/x/term"
+)
+
+type CredentialCmd struct {
+	Store CredentialStoreCmd `cmd:"" help:"Store token and secret of the publisher with the credential helper"`
+	Get   CredentialGetCmd   `cmd:"" help:"Show which credentials the credential helper returns"`
+	Erase CredentialEraseCmd `cmd:"" help:"Remove the credentials of the publisher from the credential helper"`
+}
+
+type CredentialStoreCmd struct {
+	Token  bool `optional:"" help:"Ask for the access token"`
+	Secret bool `optional:"" help:"Ask for the HMAC secret"`
+}
+
+type CredentialGetCmd struct{}
+
+type CredentialEraseCmd struct{}
+
+// runCredential manages the credentials of the publisher in the
+// configured credential helper
+func runCredential(cfg hashref.Config, command string, outFile *os.File) {
+	helper := hashref.NewCredentialHelper(cfg, askPassphrase)
+	if helper == nil {
+		usageError("no credential helper configured, set HASHREF_CREDENTIAL_HELPER")
+	}
+	req := hashref.CredentialRequest{Server: cfg.HashrefServer, Publisher: cfg.Publisher}
+	switch command {
+	case "store":
+		if !CLI.Credential.Store.Token && !CLI.Credential.Store.Secret {
+			usageError("provide --token and/or --secret")
+		}
+		creds, err := helper.Get(req)
+		if err != nil {
+			usageError("%v", err)
+		}
+		if CLI.Credential.Store.Token {
+			creds.Token = askSecret("Token: ")
+		}
+		if CLI.Credential.Store.Secret {
+			creds.Secret = askSecret("Secret: ")
+		}
+		if err := helper.Store(req, creds); err != nil {
+			usageError("%v", err)
+		}
+		fmt.Fprintf(outFile, "Credentials of %v for %v stored :)\n", req.Publisher, req.Server)
+	case "get":
+		creds, err := helper.Get(req)
+		if err != nil {
+			usageError("%v", err)
+		}
+		fmt.Fprintf(outFile, "Token: %v\n", masked(creds.Token))
+		fmt.Fprintf(outFile, "Secret: %v\n", masked(creds.Secret))
+	case "erase":
+		if err := helper.Erase(req); err != nil {
+			usageError("%v", err)
+		}
+		fmt.Fprintf(outFile, "Credentials of %v for %v erased :)\n", req.Publisher, req.Server)
+	}
+}
+
+// askPassphrase returns the passphrase of the encrypted credential store
+// from the environment or asks on the terminal
+func askPassphrase() ([]byte, error) {
+	if passphrase := os.Getenv(hashref.PassphraseEnv); passphrase != "" {
+		return []byte(passphrase), nil
+	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return nil, fmt.Errorf("no passphrase for credential store, set %v", hashref.PassphraseEnv)
+	}
+	fmt.Fprint(os.Stderr, "Credential store passphrase: ")
+	passphrase, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	return passphrase, err
+}
+
+// stdinReader is shared by all prompts, a buffered reader per prompt
+// would consume the lines of the following prompts
+var stdinReader = bufio.NewReader(os.Stdin)
+
+// askSecret reads a value without echo from the terminal or a line from
+// stdin
+func askSecret(prompt string) string {
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		fmt.Fprint(os.Stderr, prompt)
+		b, err := term.ReadPassword(int(os.Stdin.Fd()))
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			usageError("%v", err)
+		}
+		return string(b)
+	}
+	value, err := stdinReader.ReadString('\n')
+	if err != nil && (err != io.EOF || value == "") {
+		usageError("reading %v%v", strings.ToLower(prompt), err)
+	}
+	return strings.TrimRight(value, "\r\n")
+}
+
+func masked(value string) string {
+	if value == "" {
+		return "not set"
+	}
+	return "***"
+}
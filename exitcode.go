@@ -0,0 +1,62 @@
+package main
+
+import (
+	"github.com/NodyHub/hashref/pkg/hashref"
+)
+
+// Exit codes of the cli, if several inputs result in different codes
+// the most severe one wins, see exitSeverity
+const (
+	ExitOK              = 0 // all inputs found, set or removed
+	ExitNotFound        = 1 // at least one input is unknown to the server
+	ExitUsage           = 2 // invalid flags, arguments, queries or templates
+	ExitServerError     = 3 // server or network error
+	ExitAuthError       = 4 // server rejected the credentials
+	ExitPolicyViolation = 5 // a policy rule matched
+	ExitDrift           = 6 // files differ from the lock file
+)
+
+// exitSeverity orders the exit codes from least to most severe
+var exitSeverity = []int{ExitOK, ExitNotFound, ExitDrift, ExitPolicyViolation, ExitServerError, ExitAuthError, ExitUsage}
+
+// exitStatus tracks the most severe exit code over all inputs
+type exitStatus struct {
+	code       int
+	notFoundOk bool
+}
+
+// Update raises the exit code if the provided code is more severe
+func (e *exitStatus) Update(code int) {
+	if code == ExitNotFound && e.notFoundOk {
+		return
+	}
+	if severity(code) > severity(e.code) {
+		e.code = code
+	}
+}
+
+// UpdateResult raises the exit code based on the result
+func (e *exitStatus) UpdateResult(r hashref.Result) {
+	switch {
+	case r.Unauthorized():
+		e.Update(ExitAuthError)
+	case r.Failed():
+		e.Update(ExitServerError)
+	case r.Status == hashref.StatusNotFound:
+		e.Update(ExitNotFound)
+	}
+}
+
+// Code returns the exit code
+func (e *exitStatus) Code() int {
+	return e.code
+}
+
+func severity(code int) int {
+	for i, c := range exitSeverity {
+		if c == code {
+			return i
+		}
+	}
+	return len(exitSeverity)
+}
@@ -3,3 +3,13 @@ module github.com/NodyHub/hashref
 go 1.18
 
 require github.com/alecthomas/kong v0.7.1
+
+require gopkg.in/yaml.v3 v3.0.1
+
+require (
+	github.com/BurntSushi/toml v1.3.2
+	golang.org/x/crypto v0.17.0
+	golang.org/x/term v0.15.0
+)
+
+require golang.org/x/sys v0.15.0 // indirect
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/NodyHub/hashref/pkg/hashref"
+	"github.com/NodyHub/hashref/pkg/util"
+)
+
+type KeygenCmd struct {
+	Key string `short:"k" optional:"" type:"path" help:"Path of the private key (default: HASHREF_SIGNING_KEY or ~/.hashref.key), the public key is written to <key>.pub"`
+}
+
+// runKeygen generates a signing key pair
+func runKeygen(cfg hashref.Config, outFile *os.File) {
+	path := CLI.Keygen.Key
+	if path == "" {
+		path = cfg.SigningKey
+	}
+	if path == "" {
+		dirname, err := os.UserHomeDir()
+		if err != nil {
+			usageError("could not figure out USER_HOME, provide --key")
+		}
+		path = filepath.Join(dirname, ".hashref.key")
+	}
+
+	// Check if key needs to be overwritten
+	if _, err := os.Stat(path); err == nil {
+		if !CLI.Yes && !util.YesOrNoQuestion(fmt.Sprintf("Overwrite existing key %v?", path)) {
+			fmt.Fprintf(outFile, "Aborted\n")
+			return
+		}
+	}
+
+	publicKey, err := hashref.GenerateKey(path)
+	if err != nil {
+		usageError("%v", err)
+	}
+	fmt.Fprintf(outFile, "Key pair written to %v and %v.pub :)\n", path, path)
+	fmt.Fprintf(outFile, "Public key: %v\n", publicKey)
+	if cfg.SigningKey != path {
+		fmt.Fprintf(outFile, "Set HASHREF_SIGNING_KEY=%v to sign published metadata\n", path)
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/NodyHub/hashref/pkg/hashref"
+	"github.com/NodyHub/hashref/pkg/output"
+	"github.com/NodyHub/hashref/pkg/policy"
+	"github.com/NodyHub/hashref/pkg/util"
+)
+
+type LockCmd struct {
+	Lockfile string   `short:"l" default:"hashref.lock" type:"path" help:"Path of the lock file"`
+	Keys     string   `short:"k" optional:"" help:"Comma separated metadata keys to record (default: permission,size)"`
+	Paths    []string `arg:"" optional:"" type:"path" help:"Files and directories to lock (default: .)"`
+}
+
+type VerifyCmd struct {
+	Lockfile string `short:"l" default:"hashref.lock" type:"existingfile" help:"Path of the lock file"`
+	Remote   bool   `optional:"" help:"Additionally lookup every hash on the server"`
+}
+
+// runLock generates the lock file
+func runLock(hc *hashref.HashrefClient, outFile *os.File) {
+	roots := CLI.Lock.Paths
+	if len(roots) == 0 {
+		roots = []string{"."}
+	}
+	var keys []string
+	if CLI.Lock.Keys != "" {
+		keys = strings.Split(CLI.Lock.Keys, ",")
+	}
+
+	// Check if lock file needs to be overwritten
+	if _, err := os.Stat(CLI.Lock.Lockfile); err == nil {
+		if !CLI.Yes && !util.YesOrNoQuestion(fmt.Sprintf("Overwrite existing lock file %v?", CLI.Lock.Lockfile)) {
+			fmt.Fprintf(outFile, "Aborted\n")
+			return
+		}
+	}
+
+	lock, err := hc.CreateLock(CLI.Lock.Lockfile, roots, keys)
+	if err != nil {
+		usageError("%v", err)
+	}
+	if err := lock.Write(CLI.Lock.Lockfile); err != nil {
+		usageError("%v", err)
+	}
+	fmt.Fprintf(outFile, "%v written with %v files :)\n", CLI.Lock.Lockfile, len(lock.Files))
+}
+
+// runVerify compares the files against the lock file and reports a
+// drift exit code if any file is modified, added or missing
+func runVerify(hc *hashref.HashrefClient, pol *policy.Policy, out output.Writer, status *exitStatus) {
+	lock, err := hashref.LoadLockFile(CLI.Verify.Lockfile)
+	if err != nil {
+		usageError("%v", err)
+	}
+	results, err := hc.VerifyLock(CLI.Verify.Lockfile, lock)
+	if err != nil {
+		usageError("%v", err)
+	}
+	for _, result := range results {
+		if result.Status != hashref.StatusUnchanged {
+			status.Update(ExitDrift)
+		}
+
+		// Cross check the current hash on the server
+		if CLI.Verify.Remote && result.Status != hashref.StatusMissing {
+			success, meta := hc.GetRemoteData(hashref.File, result.Input, result.Hash)
+			remote := hashref.NewLookupResult(hashref.File, result.Input, result.Hash, success, meta)
+			status.UpdateResult(remote)
+			applyPolicy(pol, &remote, status)
+			result.Violations = remote.Violations
+			if result.Meta == nil {
+				result.Meta = map[string]interface{}{}
+			}
+			result.Meta["remote"] = remote.Status
+			if remote.Error != "" {
+				result.Error = remote.Error
+			}
+		}
+		writeResult(out, result)
+	}
+}
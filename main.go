@@ -1,35 +1,70 @@
 package main
 
 import (
-	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
+	"strings"
 
 	"github.com/NodyHub/hashref/pkg/hashref"
+	"github.com/NodyHub/hashref/pkg/output"
+	"github.com/NodyHub/hashref/pkg/policy"
+	"github.com/NodyHub/hashref/pkg/query"
 	"github.com/NodyHub/hashref/pkg/util"
 	"github.com/alecthomas/kong"
 )
 
 var CLI struct {
-	Config    string `short:"c" optional:"" type:"path" help:"Path to hashref config (default: ~/.hashref). Fields can be overwritten in environment."`
-	Details   bool   `short:"d" optional:"" help:"Show details to hash."`
-	Generate  bool   `short:"g" optional:"" help:"Generate client configuration"`
-	Meta      string `short:"m" optional:"" type:"path" help:"Read metadata from JSON file, comma separated file list, existing keys are overwritten. Empty values are removed from metadata."`
-	Remove    bool   `short:"r" optional:"" help:"Remove hash from db"`
-	Set       bool   `short:"s" optional:"" help:"Set metadata for input/self."`
-	Self      bool   `optional:"" help:"Set/get metadata to yourself"`
-	Output    string `short:"o" optional:"" help:"Specify output (default: STDERR, - for STDOUT)" type:"path"`
-	Publisher string `short:"p" optional:"" help:"Restrict result to publisher"`
-	Verbose   bool   `short:"v" optional:"" help:"Verbose output"`
-	Yes       bool   `short:"y" optional:"" help:"Always confirm"`
+	Aggregate     bool   `short:"a" optional:"" help:"Group lookup metadata per publisher, compute consensus per key and flag conflicts"`
+	Check         string `optional:"" type:"existingfile" help:"Verify files of a sha256sum compatible checksum file (GNU or BSD format) and lookup their hashes"`
+	Collectors    string `optional:"" help:"Comma separated collectors to enable, -name disables, all/-all for every collector (e.g. -all,file,git)"`
+	Config        string `short:"c" optional:"" type:"path" help:"Path to hashref config, replaces the user and project configs (default: ~/.config/hashref/config, ~/.hashref and .hashref of the working directory). Fields can be overwritten in environment."`
+	Details       bool   `short:"d" optional:"" help:"Show details to hash."`
+	Fields        string `optional:"" help:"Comma separated metadata keys to show, nested keys are separated by '.' (e.g. publishers.*.verdict)"`
+	Format        string `short:"f" optional:"" default:"text" enum:"text,json,ndjson,csv,yaml,table,sha256sum,bsd" help:"Output format (text, json, ndjson, csv, yaml, table, sha256sum, bsd)"`
+	Generate      bool   `short:"g" optional:"" help:"Generate client configuration"`
+	GenFormat     string `name:"generate-format" optional:"" enum:",json,yaml,toml" default:"" help:"Format of --generate (json, yaml, toml), default: by --output extension or json"`
+	Meta          string `short:"m" optional:"" type:"path" help:"Read metadata from JSON file, comma separated file list, existing keys are overwritten. Empty values are removed from metadata."`
+	Remove        bool   `short:"r" optional:"" help:"Remove hash from db"`
+	Set           bool   `short:"s" optional:"" help:"Set metadata for input/self."`
+	Self          bool   `optional:"" help:"Set/get metadata to yourself"`
+	Output        string `short:"o" optional:"" help:"Specify output (default: STDERR, - for STDOUT)" type:"path"`
+	Template      string `optional:"" help:"Render each result with a Go text/template, overrides --format"`
+	TmplFile      string `name:"template-file" optional:"" type:"existingfile" help:"Read --template from file"`
+	Policy        string `optional:"" type:"existingfile" help:"Evaluate the rules of a policy file (YAML/JSON) against every lookup"`
+	RequireSigned bool   `name:"require-signed" optional:"" help:"Treat metadata without verified signature as absent"`
+	Query         string `short:"q" optional:"" help:"jq-like expression to filter/transform the metadata, results without output are dropped"`
+	Profile       string `optional:"" help:"Use the named profile of the config (default: HASHREF_PROFILE or the current profile)"`
+	Publisher     string `short:"p" optional:"" help:"Restrict result to publisher"`
+	Verbose       bool   `short:"v" optional:"" help:"Verbose output"`
+	Yes           bool   `short:"y" optional:"" help:"Always confirm"`
+
+	NotFoundOk bool `name:"not-found-ok" optional:"" help:"Treat inputs unknown to the server as success for the exit code"`
+
+	Lookup LookupCmd `cmd:"" default:"withargs" help:"Get, set or remove metadata of files, strings and hashes (default, explicit for inputs named like a command)"`
+	Lock   LockCmd   `cmd:"" help:"Generate a lock file with hashes and metadata of all files below the paths"`
+	Verify VerifyCmd `cmd:"" help:"Verify files against a lock file"`
+	Keygen KeygenCmd `cmd:"" help:"Generate an Ed25519 key pair to sign published metadata"`
+	Token  TokenCmd  `cmd:"" help:"Manage access tokens for service accounts"`
+
+	Credential CredentialCmd `cmd:"" help:"Store credentials with the credential helper"`
+
+	ConfigCmd ConfigCmd `cmd:"" name:"config" help:"Switch and show config profiles"`
+}
 
+type LookupCmd struct {
 	Input []string `arg:"" name:"input" optional:"" help:"Files, strings, hashes"`
 }
 
 func main() {
-	_ = kong.Parse(&CLI)
+	ctx := kong.Parse(&CLI, kong.Exit(func(code int) {
+		// Parse errors are reported as usage error
+		if code != 0 {
+			code = ExitUsage
+		}
+		os.Exit(code)
+	}))
 	// Check for verbose output
 	if CLI.Verbose {
 		log.SetOutput(os.Stderr)
@@ -39,16 +74,16 @@ func main() {
 	log.Printf("Flags: %+v\n", CLI)
 
 	// Adjust output
-	output := os.Stderr
+	outFile := os.Stderr
 	if CLI.Output == "-" {
-		output = os.Stdout
+		outFile = os.Stdout
 	} else if CLI.Output != "" {
 		// Check if file needs to be overwritten
 		if _, err := os.Stat(CLI.Output); err == nil {
 			// File exist, do we have --yes flag or ask?
 			if !CLI.Yes && !util.YesOrNoQuestion(fmt.Sprintf("Overwrite existing file %v?", CLI.Output)) {
 				log.Println("Aborted")
-				os.Exit(-1)
+				os.Exit(ExitUsage)
 			} else {
 				log.Printf("Overwrite %v\n", CLI.Output)
 			}
@@ -56,40 +91,156 @@ func main() {
 		// Open file for output
 		out, err := os.OpenFile(CLI.Output, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
 		if err != nil {
-			log.Fatal(err)
+			usageError("%v", err)
 		}
-		output = out
+		outFile = out
 	}
 
 	// Generate hashref config
 	if CLI.Generate {
 		cfg := hashref.NewConfig()
-		cfg.LoadEnvValues()
-		b, err := json.MarshalIndent(cfg, "", "    ")
+		if err := cfg.LoadEnvValues(); err != nil {
+			usageError("%v", err)
+		}
+		generated := cfg.Fields()
+		if CLI.Profile != "" {
+			profile, err := cfg.AsProfile(CLI.Profile)
+			if err != nil {
+				usageError("%v", err)
+			}
+			generated = profile
+		}
+		format := CLI.GenFormat
+		if format == "" {
+			format = hashref.FormatByExtension(CLI.Output)
+		}
+		if format == "" {
+			format = hashref.FormatJSON
+		}
+		b, err := hashref.EncodeConfig(format, generated)
 		if err != nil {
-			log.Fatal(err)
+			usageError("%v", err)
 		}
-		fmt.Fprintf(output, "%v\n", string(b))
+		fmt.Fprintf(outFile, "%s", b)
 		os.Exit(0)
 	}
 
+	// Prepare result output
+	if CLI.TmplFile != "" {
+		b, err := os.ReadFile(CLI.TmplFile)
+		if err != nil {
+			usageError("%v", err)
+		}
+		CLI.Template = string(b)
+	}
+	var out output.Writer
+	var err error
+	if CLI.Template != "" {
+		out, err = output.NewTemplate(CLI.Template, outFile)
+	} else {
+		// The self metadata is always printed in detail
+		details := CLI.Details || (CLI.Self && !CLI.Set)
+		out, err = output.New(CLI.Format, outFile, details)
+	}
+	if err != nil {
+		usageError("%v", err)
+	}
+
+	// Filter and project metadata before output
+	if CLI.Query != "" || CLI.Fields != "" {
+		var q *query.Query
+		if CLI.Query != "" {
+			if q, err = query.Parse(CLI.Query); err != nil {
+				usageError("invalid query: %v", err)
+			}
+		}
+		var fields []string
+		if CLI.Fields != "" {
+			fields = strings.Split(CLI.Fields, ",")
+		}
+		out = output.Transform(out, metadataTransform(q, fields))
+	}
+
+	// Load policy for lookups
+	var pol *policy.Policy
+	if CLI.Policy != "" {
+		if pol, err = policy.Load(CLI.Policy); err != nil {
+			usageError("%v", err)
+		}
+	}
+
 	// Load local cfg file for client
-	cfg := hashref.LoadConfig(CLI.Config)
-	cfg.LoadEnvValues()
+	cfg, err := hashref.LoadConfig(CLI.Config)
+	command := strings.Fields(ctx.Command())
+	if command[0] == "config" {
+		runConfig(cfg, err, command[1], outFile)
+		os.Exit(ExitOK)
+	}
+	if err != nil {
+		usageError("%v", err)
+	}
+	if err := resolveConfig(&cfg, CLI.Profile); err != nil {
+		usageError("%v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		usageError("%v", err)
+	}
 	hc := hashref.NewClient(cfg)
+	hc.SetPassphrase(askPassphrase)
+
+	// track status overall
+	status := exitStatus{notFoundOk: CLI.NotFoundOk}
+
+	// Dispatch sub commands, lookup is handled below
+	switch command[0] {
+	case "lock":
+		runLock(&hc, outFile)
+		os.Exit(ExitOK)
+	case "keygen":
+		runKeygen(cfg, outFile)
+		os.Exit(ExitOK)
+	case "token":
+		os.Exit(runToken(&hc, command[1], outFile))
+	case "credential":
+		runCredential(cfg, command[1], outFile)
+		os.Exit(ExitOK)
+	case "verify":
+		runVerify(&hc, pol, out, &status)
+		closeOutput(out)
+		os.Exit(status.Code())
+	}
+
+	// Handle checksum files
+	if CLI.Check != "" {
+		runCheck(&hc, pol, out, &status)
+		closeOutput(out)
+		os.Exit(status.Code())
+	}
 
 	// handle management of our own data
 	if CLI.Self {
+		selfHash := hashref.CalculateHash([]byte(cfg.Publisher))
 		if CLI.Set {
 			// Collect all the metadata
 			meta := map[string]interface{}{
 				"user": cfg.Publisher,
-				"hash": hashref.CalculateHash([]byte(cfg.Publisher)),
+				"hash": selfHash,
 				"type": hashref.Lookup[hashref.Publisher],
 			}
 
+			// Publish the key to verify our signatures
+			if publicKey, err := hc.PublicKey(); err != nil {
+				log.Printf("ERROR: %v\n", err)
+			} else if publicKey != "" {
+				meta["public_key"] = publicKey
+			}
+
 			// Extend with metadata from config
-			for k, v := range cfg.DefaultMeta {
+			defaultMeta, err := cfg.ExpandDefaultMeta(hashref.Publisher, cfg.Publisher, selfHash)
+			if err != nil {
+				usageError("%v", err)
+			}
+			for k, v := range defaultMeta {
 				meta[k] = v
 			}
 
@@ -106,65 +257,46 @@ func main() {
 			}
 
 			// Perform request
-			if success := hc.SetSelf(meta); success {
-
-				// Detailed output or status?
-				if CLI.Details {
-
-					// Pretty print details
-					if pretty, err := util.GetPrettyJsonFromMap(meta); err != nil {
-						log.Printf("%v\n", err)
-					} else {
-						fmt.Fprintf(output, "%v\n", pretty)
-					}
-
-				} else {
-					// Just print the success
-					fmt.Fprintf(output, "Self-metadata set :)\n")
-				}
-
-			} else {
-				fmt.Fprintf(output, "Error setting self-metadata :(\n")
-			}
+			success, resp := hc.SetSelf(meta)
+			result := hashref.NewResult(hashref.Publisher, cfg.Publisher, selfHash, success, resp, hashref.StatusSet, hashref.StatusNotSet)
+			status.UpdateResult(result)
+			writeResult(out, result)
 
 		} else {
-			meta := hc.GetSelf()
-			if pretty, err := util.GetPrettyJsonFromMap(meta); err != nil {
-				log.Printf("%v\n", err)
-			} else {
-				fmt.Fprintf(output, "%v\n", pretty)
-			}
+			success, meta := hc.GetSelf()
+			result := hashref.NewLookupResult(hashref.Publisher, cfg.Publisher, selfHash, success, meta)
+			status.UpdateResult(result)
+			applyPolicy(pol, &result, &status)
+			writeResult(out, result)
 		}
-		os.Exit(0)
+		closeOutput(out)
+		os.Exit(status.Code())
 	}
 
 	// Handle hash removal
 	if CLI.Remove {
-		for _, input := range CLI.Input {
+		for _, input := range CLI.Lookup.Input {
 			log.Printf("Process input %v\n", input)
-			_, calculatedHash := hashref.GetHashTypeAndValue(input)
-			if success := hc.RemoveHash(CLI.Yes, input, calculatedHash); success {
-				fmt.Fprintf(output, "%v removed :)\n", input)
-			} else {
-				fmt.Fprintf(output, "%v not removed :(\n", input)
-			}
+			inputType, calculatedHash := hashref.GetHashTypeAndValue(input)
+			success, resp := hc.RemoveHash(CLI.Yes, input, calculatedHash)
+			result := hashref.NewResult(inputType, input, calculatedHash, success, resp, hashref.StatusRemoved, hashref.StatusNotRemoved)
+			status.UpdateResult(result)
+			writeResult(out, result)
 		}
 
 		// Quit cli, action done
-		return
+		closeOutput(out)
+		os.Exit(status.Code())
 	}
 
 	// iterate over input
-	if len(CLI.Input) > 0 {
-
-		// track status overall
-		successAll := true
+	if len(CLI.Lookup.Input) > 0 {
 
 		// track processed files
 		allKeys := make(map[string]bool)
 
 		// iterate over input
-		for _, input := range CLI.Input {
+		for _, input := range CLI.Lookup.Input {
 
 			// check if already processed
 			if _, isProcessed := allKeys[input]; !isProcessed {
@@ -180,7 +312,16 @@ func main() {
 					meta := hc.CollectLocalMetadata(inputType, input, calculatedHash)
 
 					// Extend with metadata from config
-					for k, v := range cfg.DefaultMeta {
+					defaultMeta, err := cfg.ExpandDefaultMeta(inputType, input, calculatedHash)
+					if err != nil {
+						log.Printf("ERROR: %v\n", err)
+						result := hashref.NewResult(inputType, input, calculatedHash, false, map[string]interface{}{"error": err.Error()}, hashref.StatusSet, hashref.StatusNotSet)
+						status.UpdateResult(result)
+						writeResult(out, result)
+						allKeys[input] = true
+						continue
+					}
+					for k, v := range defaultMeta {
 						meta[k] = v
 					}
 
@@ -197,27 +338,10 @@ func main() {
 					}
 
 					// finalize
-					if success := hc.SetRemoteData(inputType, input, calculatedHash, meta); success {
-
-						// Detailed output or status?
-						if CLI.Details {
-
-							// Pretty print details
-							if pretty, err := util.GetPrettyJsonFromMap(meta); err != nil {
-								log.Printf("%v\n", err)
-							} else {
-								fmt.Fprintf(output, "%v\n", pretty)
-							}
-
-						} else {
-							// Just print the success
-							fmt.Fprintf(output, "%v metadata set :)\n", input)
-						}
-
-					} else {
-						fmt.Fprintf(output, "%v metadata not set :(\n", input)
-						successAll = false
-					}
+					success, resp := hc.SetRemoteData(inputType, input, calculatedHash, meta)
+					result := hashref.NewResult(inputType, input, calculatedHash, success, resp, hashref.StatusSet, hashref.StatusNotSet)
+					status.UpdateResult(result)
+					writeResult(out, result)
 
 				} else {
 					// Check if request is for dedicated publisher before fetch remote data
@@ -230,45 +354,14 @@ func main() {
 						success, meta = hc.GetRemoteData(inputType, input, calculatedHash)
 					}
 
-					// Fetch data from all publisher
-					if success {
-
-						// Detailed output or status?
-						if CLI.Details {
-
-							// Pretty print details
-							if pretty, err := util.GetPrettyJsonFromMap(meta); err != nil {
-								log.Printf("%v\n", err)
-							} else {
-								fmt.Fprintf(output, "%v\n", pretty)
-							}
-
-						} else {
-							// Just print the success
-							fmt.Fprintf(output, "%v found :)\n", input)
-						}
-
-					} else {
-
-						// Detailed output for sad state?
-						if CLI.Details {
-
-							// Pretty print details
-							meta["input"] = input
-							if pretty, err := util.GetPrettyJsonFromMap(meta); err != nil {
-								log.Printf("%v\n", err)
-							} else {
-								fmt.Fprintf(output, "%v\n", pretty)
-							}
-
-						} else {
-							// Just print the sad state
-							fmt.Fprintf(output, "%v not found :(\n", input)
-						}
-
-						// Remember non-success
-						successAll = false
+					// Remember non-success
+					result := hashref.NewLookupResult(inputType, input, calculatedHash, success, meta)
+					if CLI.Aggregate && success {
+						result.Aggregation = hashref.Aggregate(result.Meta)
 					}
+					status.UpdateResult(result)
+					applyPolicy(pol, &result, &status)
+					writeResult(out, result)
 				}
 
 				// Note that input is processed
@@ -280,9 +373,106 @@ func main() {
 			}
 
 		}
-		if !successAll {
-			os.Exit(-1)
-		}
+		closeOutput(out)
+		os.Exit(status.Code())
+	}
+
+}
+
+// resolveConfig applies the profile, the environment and the flags on
+// the loaded config files
+func resolveConfig(cfg *hashref.Config, profile string) error {
+	if err := cfg.ApplyProfile(profile); err != nil {
+		return err
+	}
+	if err := cfg.LoadEnvValues(); err != nil {
+		return err
+	}
+	applyFlags(cfg)
+	return nil
+}
+
+// applyFlags overwrites config values with the flags, flags are the
+// last config layer
+func applyFlags(cfg *hashref.Config) {
+	if CLI.RequireSigned {
+		cfg.RequireSigned = true
+		cfg.SetOrigin("HASHREF_REQUIRE_SIGNED", hashref.OriginFlag)
+	}
+	if CLI.Collectors != "" {
+		cfg.Collectors = append(cfg.Collectors, strings.Split(CLI.Collectors, ",")...)
+		cfg.SetOrigin("HASHREF_COLLECTORS", hashref.OriginFlag)
 	}
+}
 
+// usageError reports an invalid invocation and terminates the cli
+func usageError(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "hashref: error: "+format+"\n", args...)
+	os.Exit(ExitUsage)
+}
+
+// applyPolicy evaluates the policy against a lookup result and records
+// the violations in the result
+func applyPolicy(pol *policy.Policy, result *hashref.Result, status *exitStatus) {
+	if pol == nil {
+		return
+	}
+	violations, err := pol.Evaluate(*result)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "hashref: error: policy for %v: %v\n", result.Input, err)
+		status.Update(ExitPolicyViolation)
+	}
+	result.Violations = violations
+	if policy.Failed(violations) {
+		status.Update(ExitPolicyViolation)
+	}
+}
+
+// writeResult hands the result over to the output writer, failing
+// writers and queries are usage errors
+func writeResult(out output.Writer, result hashref.Result) {
+	if err := out.Write(result); err != nil {
+		usageError("%v", err)
+	}
+}
+
+// closeOutput flushes results that are buffered by the output writer,
+// failing writers, e.g. templates with unknown fields, are usage errors
+func closeOutput(out output.Writer) {
+	if err := out.Close(); err != nil {
+		usageError("writing output: %v", err)
+	}
+}
+
+// metadataTransform returns a function that applies the query and the
+// field projection to the metadata of a result. Query outputs that are
+// not an object are stored as "result" in the metadata.
+func metadataTransform(q *query.Query, fields []string) func(r *hashref.Result) (bool, error) {
+	return func(r *hashref.Result) (bool, error) {
+		if r.Meta == nil {
+			return true, nil
+		}
+		if q != nil {
+			values, err := q.Run(r.Meta, nil)
+			if err != nil {
+				return false, fmt.Errorf("query failed for %v: %v", r.Input, err)
+			}
+			switch len(values) {
+			case 0:
+				return false, nil
+			case 1:
+				if m, ok := values[0].(map[string]interface{}); ok {
+					r.Meta = m
+				} else {
+					r.Meta = map[string]interface{}{"result": values[0]}
+				}
+			default:
+				r.Meta = map[string]interface{}{"result": values}
+			}
+		}
+		if len(fields) > 0 {
+			r.Meta = query.Project(r.Meta, fields)
+		}
+		return true, nil
+	}
 }
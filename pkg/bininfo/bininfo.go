@@ -0,0 +1,203 @@
+// Package bininfo inspects ELF, PE and Mach-O executables and the build
+// information embedded in Go binaries.
+package bininfo
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"debug/buildinfo"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// ErrNotBinary is returned for files that are no supported executable
+var ErrNotBinary = errors.New("not an ELF, PE or Mach-O file")
+
+// Info describes an executable
+type Info struct {
+	Format    string            `json:"format"`              // elf, pe or macho
+	Arch      string            `json:"arch"`                // architecture in GOARCH notation if known
+	BuildID   string            `json:"build_id,omitempty"`  // GNU build id, PE debug signature or Mach-O UUID
+	Entry     string            `json:"entry,omitempty"`     // address of the entry point
+	Libraries []string          `json:"libraries,omitempty"` // dynamically linked libraries
+	Sections  map[string]string `json:"sections,omitempty"`  // SHA-256 of the section content
+	Go        *GoInfo           `json:"go,omitempty"`        // build information of Go binaries
+}
+
+// GoInfo is the build information of a Go binary
+type GoInfo struct {
+	Version  string            `json:"version"`
+	Path     string            `json:"path,omitempty"`
+	Main     string            `json:"main,omitempty"`
+	Modules  []string          `json:"modules,omitempty"`
+	Settings map[string]string `json:"settings,omitempty"`
+}
+
+// Analyze inspects the executable at path
+func Analyze(path string) (*Info, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	head := make([]byte, 64)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return nil, ErrNotBinary
+	}
+	head = head[:n]
+
+	var info *Info
+	switch {
+	case bytes.HasPrefix(head, []byte("\x7fELF")):
+		info, err = analyzeELF(f)
+	case isPE(f, head):
+		info, err = analyzePE(f)
+	case isMachO(head):
+		info, err = analyzeMachO(f)
+	default:
+		return nil, ErrNotBinary
+	}
+	if err != nil {
+		return nil, err
+	}
+	if bi, err := buildinfo.ReadFile(path); err == nil {
+		info.Go = goInfo(bi)
+	}
+	return info, nil
+}
+
+// isPE reports if the DOS header points to a PE signature, text starting
+// with MZ has no complete DOS header
+func isPE(r io.ReaderAt, head []byte) bool {
+	if len(head) < 64 || string(head[:2]) != "MZ" {
+		return false
+	}
+	signature := make([]byte, 4)
+	offset := int64(binary.LittleEndian.Uint32(head[0x3c:]))
+	if _, err := r.ReadAt(signature, offset); err != nil {
+		return false
+	}
+	return string(signature) == "PE\x00\x00"
+}
+
+// isMachO reports if the header has a thin or universal Mach-O magic
+func isMachO(head []byte) bool {
+	if len(head) < 8 {
+		return false
+	}
+	switch hex.EncodeToString(head[:4]) {
+	case "feedface", "feedfacf", "cefaedfe", "cffaedfe":
+		return true
+	case "cafebabe":
+		// Universal binaries have few architectures, Java class files
+		// store their version at the same position
+		return binary.BigEndian.Uint32(head[4:]) < 45
+	}
+	return false
+}
+
+// goInfo converts the build information of the go toolchain
+func goInfo(bi *buildinfo.BuildInfo) *GoInfo {
+	g := &GoInfo{Version: bi.GoVersion, Path: bi.Path}
+	if bi.Main.Path != "" {
+		g.Main = moduleString(bi.Main.Path, bi.Main.Version)
+	}
+	for _, dep := range bi.Deps {
+		if dep.Replace != nil {
+			g.Modules = append(g.Modules, fmt.Sprintf("%v => %v", moduleString(dep.Path, dep.Version), moduleString(dep.Replace.Path, dep.Replace.Version)))
+			continue
+		}
+		g.Modules = append(g.Modules, moduleString(dep.Path, dep.Version))
+	}
+	if len(bi.Settings) > 0 {
+		g.Settings = map[string]string{}
+		for _, s := range bi.Settings {
+			g.Settings[s.Key] = s.Value
+		}
+	}
+	return g
+}
+
+func moduleString(path, version string) string {
+	if version == "" {
+		return path
+	}
+	return path + "@" + version
+}
+
+// section is the content of a section for hashing
+type section struct {
+	name string
+	data func() ([]byte, error)
+}
+
+// hashSections returns the SHA-256 of the sections, names of duplicate
+// sections get their index appended
+func hashSections(sections []section) map[string]string {
+	hashes := map[string]string{}
+	for i, s := range sections {
+		data, err := s.data()
+		if err != nil || len(data) == 0 {
+			continue
+		}
+		name := s.name
+		if _, exists := hashes[name]; exists || name == "" {
+			name = fmt.Sprintf("%v#%v", name, i)
+		}
+		sum := sha256.Sum256(data)
+		hashes[name] = hex.EncodeToString(sum[:])
+	}
+	return hashes
+}
+
+// archName returns the architecture in GOARCH notation or the lower case
+// name of the format specific constant without prefix
+func archName(known map[string]string, name, prefix string) string {
+	if arch, ok := known[name]; ok {
+		return arch
+	}
+	return strings.ToLower(strings.TrimPrefix(name, prefix))
+}
+
+// Metadata returns the information as metadata with binary_ and go_
+// prefixed keys
+func (info Info) Metadata() map[string]interface{} {
+	meta := map[string]interface{}{
+		"binary_format": info.Format,
+		"binary_arch":   info.Arch,
+	}
+	if info.BuildID != "" {
+		meta["binary_build_id"] = info.BuildID
+	}
+	if info.Entry != "" {
+		meta["binary_entry"] = info.Entry
+	}
+	if len(info.Libraries) > 0 {
+		meta["binary_libraries"] = info.Libraries
+	}
+	if len(info.Sections) > 0 {
+		meta["binary_sections"] = info.Sections
+	}
+	if info.Go != nil {
+		meta["go_version"] = info.Go.Version
+		if info.Go.Path != "" {
+			meta["go_path"] = info.Go.Path
+		}
+		if info.Go.Main != "" {
+			meta["go_main"] = info.Go.Main
+		}
+		if len(info.Go.Modules) > 0 {
+			meta["go_modules"] = info.Go.Modules
+		}
+		if len(info.Go.Settings) > 0 {
+			meta["go_settings"] = info.Go.Settings
+		}
+	}
+	return meta
+}
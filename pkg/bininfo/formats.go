@@ -0,0 +1,279 @@
+package bininfo
+
+import (
+	"bytes"
+	"debug/elf"
+	"debug/macho"
+	"debug/pe"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// elfArchs maps ELF machines to GOARCH
+var elfArchs = map[string]string{
+	"EM_X86_64":    "amd64",
+	"EM_386":       "386",
+	"EM_AARCH64":   "arm64",
+	"EM_ARM":       "arm",
+	"EM_PPC64":     "ppc64",
+	"EM_S390":      "s390x",
+	"EM_RISCV":     "riscv64",
+	"EM_MIPS":      "mips",
+	"EM_LOONGARCH": "loong64",
+}
+
+func analyzeELF(r io.ReaderAt) (*Info, error) {
+	f, err := elf.NewFile(r)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info := &Info{
+		Format: "elf",
+		Arch:   archName(elfArchs, f.Machine.String(), "EM_"),
+		Entry:  fmt.Sprintf("0x%x", f.Entry),
+	}
+	if info.Arch == "ppc64" && f.ByteOrder == binary.LittleEndian {
+		info.Arch = "ppc64le"
+	}
+	if info.Arch == "mips" && f.Class == elf.ELFCLASS64 {
+		info.Arch = "mips64"
+	}
+	if f.Type != elf.ET_EXEC && f.Type != elf.ET_DYN {
+		info.Entry = ""
+	}
+	info.Libraries, _ = f.ImportedLibraries()
+
+	// GNU build id, Go build id as fallback
+	for _, name := range []string{".note.gnu.build-id", ".note.go.buildid"} {
+		s := f.Section(name)
+		if s == nil {
+			continue
+		}
+		data, err := s.Data()
+		if err != nil {
+			continue
+		}
+		if desc := noteDesc(data, f.ByteOrder); desc != nil {
+			if name == ".note.go.buildid" {
+				info.BuildID = string(desc)
+			} else {
+				info.BuildID = hex.EncodeToString(desc)
+			}
+			break
+		}
+	}
+
+	sections := []section{}
+	for _, s := range f.Sections {
+		if s.Type == elf.SHT_NOBITS || s.Type == elf.SHT_NULL {
+			continue
+		}
+		sections = append(sections, section{name: s.Name, data: s.Data})
+	}
+	info.Sections = hashSections(sections)
+	return info, nil
+}
+
+// noteDesc returns the descriptor of the first entry of an ELF note
+func noteDesc(data []byte, order binary.ByteOrder) []byte {
+	if len(data) < 12 {
+		return nil
+	}
+	nameSize := int(order.Uint32(data[0:]))
+	descSize := int(order.Uint32(data[4:]))
+	start := 12 + (nameSize+3)&^3
+	if nameSize < 0 || descSize < 0 || start+descSize > len(data) {
+		return nil
+	}
+	return data[start : start+descSize]
+}
+
+// peArchs maps PE machines to GOARCH
+var peArchs = map[uint16]string{
+	pe.IMAGE_FILE_MACHINE_AMD64: "amd64",
+	pe.IMAGE_FILE_MACHINE_I386:  "386",
+	pe.IMAGE_FILE_MACHINE_ARM64: "arm64",
+	pe.IMAGE_FILE_MACHINE_ARMNT: "arm",
+	pe.IMAGE_FILE_MACHINE_ARM:   "arm",
+}
+
+const peDebugDirectory = 6
+
+func analyzePE(r io.ReaderAt) (*Info, error) {
+	f, err := pe.NewFile(r)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info := &Info{Format: "pe", Arch: peArchs[f.Machine]}
+	if info.Arch == "" {
+		info.Arch = fmt.Sprintf("0x%x", f.Machine)
+	}
+	var debugDir pe.DataDirectory
+	switch oh := f.OptionalHeader.(type) {
+	case *pe.OptionalHeader32:
+		info.Entry = fmt.Sprintf("0x%x", uint64(oh.ImageBase)+uint64(oh.AddressOfEntryPoint))
+		if len(oh.DataDirectory) > peDebugDirectory {
+			debugDir = oh.DataDirectory[peDebugDirectory]
+		}
+	case *pe.OptionalHeader64:
+		info.Entry = fmt.Sprintf("0x%x", oh.ImageBase+uint64(oh.AddressOfEntryPoint))
+		if len(oh.DataDirectory) > peDebugDirectory {
+			debugDir = oh.DataDirectory[peDebugDirectory]
+		}
+	}
+	info.Libraries = peLibraries(f)
+	info.BuildID = peCodeView(f, r, debugDir)
+
+	sections := []section{}
+	for _, s := range f.Sections {
+		sections = append(sections, section{name: s.Name, data: s.Data})
+	}
+	info.Sections = hashSections(sections)
+	return info, nil
+}
+
+// peLibraries returns the imported DLLs, pe.File.ImportedLibraries is
+// not implemented by the standard library
+func peLibraries(f *pe.File) []string {
+	symbols, _ := f.ImportedSymbols()
+	var libraries []string
+	seen := map[string]bool{}
+	for _, sym := range symbols {
+		_, dll, ok := strings.Cut(sym, ":")
+		if ok && !seen[strings.ToLower(dll)] {
+			seen[strings.ToLower(dll)] = true
+			libraries = append(libraries, dll)
+		}
+	}
+	return libraries
+}
+
+// peCodeView returns the PDB signature (GUID and age) of the CodeView
+// debug entry in the notation of symbol servers
+func peCodeView(f *pe.File, r io.ReaderAt, dir pe.DataDirectory) string {
+	if dir.Size == 0 {
+		return ""
+	}
+	for _, s := range f.Sections {
+		if dir.VirtualAddress < s.VirtualAddress || dir.VirtualAddress+dir.Size > s.VirtualAddress+s.VirtualSize {
+			continue
+		}
+		data, err := s.Data()
+		if err != nil {
+			return ""
+		}
+		start := int(dir.VirtualAddress - s.VirtualAddress)
+		if start+int(dir.Size) > len(data) {
+			return ""
+		}
+		entries := data[start : start+int(dir.Size)]
+		for len(entries) >= 28 {
+			typ := binary.LittleEndian.Uint32(entries[12:])
+			size := binary.LittleEndian.Uint32(entries[16:])
+			offset := binary.LittleEndian.Uint32(entries[24:])
+			entries = entries[28:]
+			if typ != 2 || size < 24 {
+				continue
+			}
+			cv := make([]byte, 24)
+			if _, err := r.ReadAt(cv, int64(offset)); err != nil || !bytes.Equal(cv[:4], []byte("RSDS")) {
+				continue
+			}
+			guid := cv[4:20]
+			return strings.ToUpper(fmt.Sprintf("%08x%04x%04x%x%x",
+				binary.LittleEndian.Uint32(guid[0:]),
+				binary.LittleEndian.Uint16(guid[4:]),
+				binary.LittleEndian.Uint16(guid[6:]),
+				guid[8:],
+				binary.LittleEndian.Uint32(cv[20:])))
+		}
+		return ""
+	}
+	return ""
+}
+
+// machoArchs maps Mach-O CPUs to GOARCH
+var machoArchs = map[macho.Cpu]string{
+	macho.CpuAmd64: "amd64",
+	macho.Cpu386:   "386",
+	macho.CpuArm64: "arm64",
+	macho.CpuArm:   "arm",
+	macho.CpuPpc64: "ppc64",
+	macho.CpuPpc:   "ppc",
+}
+
+// Mach-O load commands and section types
+const (
+	machoLoadUUID         = 0x1b
+	machoLoadMain         = 0x80000028
+	machoZerofill         = 0x1
+	machoGBZerofill       = 0xc
+	machoThreadLocalZeros = 0x12
+)
+
+func analyzeMachO(r io.ReaderAt) (*Info, error) {
+	f, err := macho.NewFile(r)
+	if err != nil {
+		// Universal binaries are described by their first architecture
+		fat, fatErr := macho.NewFatFile(r)
+		if fatErr != nil {
+			return nil, err
+		}
+		defer fat.Close()
+		if len(fat.Arches) == 0 {
+			return nil, ErrNotBinary
+		}
+		info := machoInfo(fat.Arches[0].File)
+		archs := []string{}
+		for _, a := range fat.Arches {
+			archs = append(archs, machoArch(a.Cpu))
+		}
+		info.Arch = strings.Join(archs, ",")
+		return info, nil
+	}
+	defer f.Close()
+	return machoInfo(f), nil
+}
+
+func machoArch(cpu macho.Cpu) string {
+	if arch, ok := machoArchs[cpu]; ok {
+		return arch
+	}
+	return strings.ToLower(strings.TrimPrefix(cpu.String(), "Cpu"))
+}
+
+func machoInfo(f *macho.File) *Info {
+	info := &Info{Format: "macho", Arch: machoArch(f.Cpu)}
+	info.Libraries, _ = f.ImportedLibraries()
+	for _, l := range f.Loads {
+		raw := l.Raw()
+		if len(raw) < 24 {
+			continue
+		}
+		switch f.ByteOrder.Uint32(raw) {
+		case machoLoadUUID:
+			u := raw[8:24]
+			info.BuildID = fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:16])
+		case machoLoadMain:
+			entryOff := f.ByteOrder.Uint64(raw[8:])
+			if text := f.Segment("__TEXT"); text != nil {
+				info.Entry = fmt.Sprintf("0x%x", text.Addr+entryOff)
+			}
+		}
+	}
+	sections := []section{}
+	for _, s := range f.Sections {
+		switch s.Flags & 0xff {
+		case machoZerofill, machoGBZerofill, machoThreadLocalZeros:
+			continue
+		}
+		sections = append(sections, section{name: s.Seg + "," + s.Name, data: s.Data})
+	}
+	info.Sections = hashSections(sections)
+	return info
+}
@@ -0,0 +1,422 @@
+package bininfo
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"debug/elf"
+	"debug/macho"
+	"debug/pe"
+	"encoding/binary"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+func sha(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// writeFixture stores the content in a temporary file
+func writeFixture(t *testing.T, content []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "fixture")
+	if err := os.WriteFile(path, content, 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// note returns an ELF note entry with padded name and descriptor
+func note(order binary.ByteOrder, name string, typ uint32, desc []byte) []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, order, []uint32{uint32(len(name) + 1), uint32(len(desc)), typ})
+	buf.WriteString(name + "\x00")
+	for buf.Len()%4 != 0 {
+		buf.WriteByte(0)
+	}
+	buf.Write(desc)
+	return buf.Bytes()
+}
+
+type elfSection struct {
+	name string
+	typ  elf.SectionType
+	data []byte
+}
+
+// buildELF returns a 64-bit ELF file without program headers
+func buildELF(order binary.ByteOrder, machine elf.Machine, typ elf.Type, sections []elfSection) []byte {
+	data := elf.ELFDATA2LSB
+	if order == binary.BigEndian {
+		data = elf.ELFDATA2MSB
+	}
+	sections = append(sections, elfSection{".shstrtab", elf.SHT_STRTAB, nil})
+	shstrtab := []byte{0}
+	names := make([]uint32, len(sections))
+	for i, s := range sections {
+		names[i] = uint32(len(shstrtab))
+		shstrtab = append(shstrtab, s.name+"\x00"...)
+	}
+	sections[len(sections)-1].data = shstrtab
+
+	var body bytes.Buffer
+	headers := []elf.Section64{{}}
+	for i, s := range sections {
+		h := elf.Section64{Name: names[i], Type: uint32(s.typ), Off: uint64(64 + body.Len()), Size: uint64(len(s.data)), Addralign: 1}
+		if s.typ == elf.SHT_NOBITS {
+			h.Size = 0x100
+		} else {
+			body.Write(s.data)
+		}
+		headers = append(headers, h)
+	}
+	for body.Len()%8 != 0 {
+		body.WriteByte(0)
+	}
+
+	header := elf.Header64{
+		Type:      uint16(typ),
+		Machine:   uint16(machine),
+		Version:   uint32(elf.EV_CURRENT),
+		Entry:     0x401000,
+		Shoff:     uint64(64 + body.Len()),
+		Ehsize:    64,
+		Phentsize: 56,
+		Shentsize: 64,
+		Shnum:     uint16(len(headers)),
+		Shstrndx:  uint16(len(headers) - 1),
+	}
+	copy(header.Ident[:], "\x7fELF")
+	header.Ident[elf.EI_CLASS] = byte(elf.ELFCLASS64)
+	header.Ident[elf.EI_DATA] = byte(data)
+	header.Ident[elf.EI_VERSION] = byte(elf.EV_CURRENT)
+
+	var buf bytes.Buffer
+	binary.Write(&buf, order, header)
+	buf.Write(body.Bytes())
+	binary.Write(&buf, order, headers)
+	return buf.Bytes()
+}
+
+func TestNoteDesc(t *testing.T) {
+	desc := []byte{1, 2, 3, 4, 5}
+	tests := []struct {
+		name  string
+		data  []byte
+		order binary.ByteOrder
+		want  []byte
+	}{
+		{"little endian", note(binary.LittleEndian, "GNU", 3, desc), binary.LittleEndian, desc},
+		{"big endian", note(binary.BigEndian, "GNU", 3, desc), binary.BigEndian, desc},
+		{"padded name", note(binary.LittleEndian, "Go", 4, desc), binary.LittleEndian, desc},
+		{"empty descriptor", note(binary.LittleEndian, "GNU", 3, nil), binary.LittleEndian, []byte{}},
+		{"truncated descriptor", note(binary.LittleEndian, "GNU", 3, desc)[:18], binary.LittleEndian, nil},
+		{"wrong byte order", note(binary.LittleEndian, "GNU", 3, desc), binary.BigEndian, nil},
+		{"short header", []byte{4, 0, 0, 0, 5, 0, 0, 0}, binary.LittleEndian, nil},
+		{"huge sizes", []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 3, 0, 0, 0}, binary.LittleEndian, nil},
+	}
+	for _, tt := range tests {
+		if got := noteDesc(tt.data, tt.order); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%v: noteDesc() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestAnalyzeELF(t *testing.T) {
+	buildID := []byte{0xde, 0xad, 0xbe, 0xef, 1, 2, 3, 4}
+	text := []byte{0x90, 0x90, 0xc3}
+	gnu := elfSection{".note.gnu.build-id", elf.SHT_NOTE, note(binary.LittleEndian, "GNU", 3, buildID)}
+	goID := elfSection{".note.go.buildid", elf.SHT_NOTE, note(binary.LittleEndian, "Go", 4, []byte("go-id/abc"))}
+	tests := []struct {
+		name     string
+		order    binary.ByteOrder
+		machine  elf.Machine
+		typ      elf.Type
+		sections []elfSection
+		arch     string
+		buildID  string
+		entry    string
+	}{
+		{"gnu build id", binary.LittleEndian, elf.EM_X86_64, elf.ET_EXEC, []elfSection{gnu, {".text", elf.SHT_PROGBITS, text}}, "amd64", "deadbeef01020304", "0x401000"},
+		{"gnu before go build id", binary.LittleEndian, elf.EM_AARCH64, elf.ET_DYN, []elfSection{goID, gnu}, "arm64", "deadbeef01020304", "0x401000"},
+		{"go build id", binary.LittleEndian, elf.EM_X86_64, elf.ET_EXEC, []elfSection{goID}, "amd64", "go-id/abc", "0x401000"},
+		{"ppc64le", binary.LittleEndian, elf.EM_PPC64, elf.ET_EXEC, nil, "ppc64le", "", "0x401000"},
+		{"ppc64", binary.BigEndian, elf.EM_PPC64, elf.ET_EXEC, nil, "ppc64", "", "0x401000"},
+		{"unknown machine", binary.BigEndian, elf.EM_SPARCV9, elf.ET_EXEC, nil, "sparcv9", "", "0x401000"},
+		{"object file", binary.LittleEndian, elf.EM_X86_64, elf.ET_REL, nil, "amd64", "", ""},
+	}
+	for _, tt := range tests {
+		sections := append([]elfSection{}, tt.sections...)
+		sections = append(sections, elfSection{".bss", elf.SHT_NOBITS, nil})
+		info, err := Analyze(writeFixture(t, buildELF(tt.order, tt.machine, tt.typ, sections)))
+		if err != nil {
+			t.Errorf("%v: %v", tt.name, err)
+			continue
+		}
+		if info.Format != "elf" || info.Arch != tt.arch || info.BuildID != tt.buildID || info.Entry != tt.entry || info.Go != nil {
+			t.Errorf("%v: Analyze() = %+v, want arch %v build id %v entry %q", tt.name, info, tt.arch, tt.buildID, tt.entry)
+		}
+		if _, ok := info.Sections[".bss"]; ok {
+			t.Errorf("%v: NOBITS section hashed", tt.name)
+		}
+		for _, s := range tt.sections {
+			if info.Sections[s.name] != sha(s.data) {
+				t.Errorf("%v: hash of %v = %v, want %v", tt.name, s.name, info.Sections[s.name], sha(s.data))
+			}
+		}
+	}
+}
+
+// codeView returns a CodeView RSDS record with GUID 01..10 and age 1
+func codeView() []byte {
+	cv := []byte("RSDS")
+	for i := 1; i <= 16; i++ {
+		cv = append(cv, byte(i))
+	}
+	cv = append(cv, 1, 0, 0, 0)
+	return append(cv, "app.pdb\x00"...)
+}
+
+// debugEntry returns an IMAGE_DEBUG_DIRECTORY entry
+func debugEntry(typ uint32, data []byte, offset uint32) []byte {
+	entry := make([]byte, 28)
+	binary.LittleEndian.PutUint32(entry[12:], typ)
+	binary.LittleEndian.PutUint32(entry[16:], uint32(len(data)))
+	binary.LittleEndian.PutUint32(entry[24:], offset)
+	return entry
+}
+
+const (
+	peSectionOffset = 0x200
+	peSectionRVA    = 0x2000
+	peSectionSize   = 0x200
+)
+
+// buildPE returns a PE file with a single .rdata section holding the
+// debug directory entries followed by their data
+func buildPE(machine uint16, pe32 bool, debug [][]byte, typs []uint32) []byte {
+	var entries, payload []byte
+	offset := peSectionOffset + uint32(len(debug)*28)
+	for i, d := range debug {
+		entries = append(entries, debugEntry(typs[i], d, offset)...)
+		payload = append(payload, d...)
+		offset += uint32(len(d))
+	}
+	content := make([]byte, peSectionSize)
+	copy(content, entries)
+	copy(content[len(entries):], payload)
+
+	var dirs [16]pe.DataDirectory
+	if len(debug) > 0 {
+		dirs[peDebugDirectory] = pe.DataDirectory{VirtualAddress: peSectionRVA, Size: uint32(len(entries))}
+	}
+	var optional interface{}
+	size := uint16(240)
+	if pe32 {
+		optional = pe.OptionalHeader32{Magic: 0x10b, AddressOfEntryPoint: 0x1000, ImageBase: 0x400000, NumberOfRvaAndSizes: 16, DataDirectory: dirs}
+		size = 224
+	} else {
+		optional = pe.OptionalHeader64{Magic: 0x20b, AddressOfEntryPoint: 0x1000, ImageBase: 0x140000000, NumberOfRvaAndSizes: 16, DataDirectory: dirs}
+	}
+
+	var buf bytes.Buffer
+	dos := make([]byte, 64)
+	copy(dos, "MZ")
+	binary.LittleEndian.PutUint32(dos[0x3c:], 64)
+	buf.Write(dos)
+	buf.WriteString("PE\x00\x00")
+	binary.Write(&buf, binary.LittleEndian, pe.FileHeader{Machine: machine, NumberOfSections: 1, SizeOfOptionalHeader: size})
+	binary.Write(&buf, binary.LittleEndian, optional)
+	header := pe.SectionHeader32{VirtualSize: peSectionSize, VirtualAddress: peSectionRVA, SizeOfRawData: peSectionSize, PointerToRawData: peSectionOffset}
+	copy(header.Name[:], ".rdata")
+	binary.Write(&buf, binary.LittleEndian, header)
+	buf.Write(make([]byte, peSectionOffset-buf.Len()))
+	buf.Write(content)
+	return buf.Bytes()
+}
+
+func TestAnalyzePE(t *testing.T) {
+	const pdb = "0403020106050807090A0B0C0D0E0F101"
+	nb10 := append([]byte("NB10"), make([]byte, 20)...)
+	tests := []struct {
+		name    string
+		machine uint16
+		pe32    bool
+		debug   [][]byte
+		typs    []uint32
+		arch    string
+		buildID string
+		entry   string
+	}{
+		{"codeview", pe.IMAGE_FILE_MACHINE_AMD64, false, [][]byte{codeView()}, []uint32{2}, "amd64", pdb, "0x140001000"},
+		{"codeview after other entries", pe.IMAGE_FILE_MACHINE_ARM64, false, [][]byte{make([]byte, 32), codeView()}, []uint32{16, 2}, "arm64", pdb, "0x140001000"},
+		{"pe32", pe.IMAGE_FILE_MACHINE_I386, true, [][]byte{codeView()}, []uint32{2}, "386", pdb, "0x401000"},
+		{"no debug directory", pe.IMAGE_FILE_MACHINE_AMD64, false, nil, nil, "amd64", "", "0x140001000"},
+		{"no codeview entry", pe.IMAGE_FILE_MACHINE_AMD64, false, [][]byte{make([]byte, 32)}, []uint32{16}, "amd64", "", "0x140001000"},
+		{"old codeview format", pe.IMAGE_FILE_MACHINE_AMD64, false, [][]byte{nb10}, []uint32{2}, "amd64", "", "0x140001000"},
+		{"short codeview entry", pe.IMAGE_FILE_MACHINE_AMD64, false, [][]byte{codeView()[:20]}, []uint32{2}, "amd64", "", "0x140001000"},
+		{"unknown machine", 0x5064, false, nil, nil, "0x5064", "", "0x140001000"},
+	}
+	for _, tt := range tests {
+		content := buildPE(tt.machine, tt.pe32, tt.debug, tt.typs)
+		info, err := Analyze(writeFixture(t, content))
+		if err != nil {
+			t.Errorf("%v: %v", tt.name, err)
+			continue
+		}
+		if info.Format != "pe" || info.Arch != tt.arch || info.BuildID != tt.buildID || info.Entry != tt.entry {
+			t.Errorf("%v: Analyze() = %+v, want arch %v build id %v entry %v", tt.name, info, tt.arch, tt.buildID, tt.entry)
+		}
+		if want := sha(content[peSectionOffset:]); info.Sections[".rdata"] != want {
+			t.Errorf("%v: hash of .rdata = %v, want %v", tt.name, info.Sections[".rdata"], want)
+		}
+	}
+}
+
+var (
+	machoUUID = []byte{0x01, 0x23, 0x45, 0x67, 0x89, 0xab, 0xcd, 0xef, 0x01, 0x23, 0x45, 0x67, 0x89, 0xab, 0xcd, 0xef}
+	machoText = []byte{0x1f, 0x20, 0x03, 0xd5}
+)
+
+const (
+	machoTextOffset = 0x400
+	machoTextAddr   = 0x100000000
+)
+
+// buildMachO returns a 64-bit Mach-O executable with a __TEXT segment of
+// a __text and a zerofill section, an UUID and an entry point
+func buildMachO(cpu macho.Cpu) []byte {
+	name := func(s string) (b [16]byte) {
+		copy(b[:], s)
+		return b
+	}
+	segment := macho.Segment64{
+		Cmd:    macho.LoadCmdSegment64,
+		Len:    72 + 2*80,
+		Name:   name("__TEXT"),
+		Addr:   machoTextAddr,
+		Memsz:  0x1000,
+		Filesz: machoTextOffset + uint64(len(machoText)),
+		Nsect:  2,
+	}
+	sections := []macho.Section64{
+		{Name: name("__text"), Seg: name("__TEXT"), Addr: machoTextAddr + machoTextOffset, Size: uint64(len(machoText)), Offset: machoTextOffset},
+		{Name: name("__bss"), Seg: name("__TEXT"), Addr: machoTextAddr + 0x800, Size: 0x100, Flags: machoZerofill},
+	}
+	var cmds bytes.Buffer
+	binary.Write(&cmds, binary.LittleEndian, segment)
+	binary.Write(&cmds, binary.LittleEndian, sections)
+	binary.Write(&cmds, binary.LittleEndian, []uint32{machoLoadUUID, 24})
+	cmds.Write(machoUUID)
+	binary.Write(&cmds, binary.LittleEndian, []uint32{machoLoadMain, 24})
+	binary.Write(&cmds, binary.LittleEndian, []uint64{machoTextOffset, 0})
+
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, macho.FileHeader{Magic: macho.Magic64, Cpu: cpu, Type: macho.TypeExec, Ncmd: 3, Cmdsz: uint32(cmds.Len())})
+	buf.Write(make([]byte, 4))
+	buf.Write(cmds.Bytes())
+	buf.Write(make([]byte, machoTextOffset-buf.Len()))
+	buf.Write(machoText)
+	return buf.Bytes()
+}
+
+// buildFat returns a universal binary of thin files aligned to 4096
+func buildFat(cpus ...macho.Cpu) []byte {
+	var header, body bytes.Buffer
+	binary.Write(&header, binary.BigEndian, []uint32{macho.MagicFat, uint32(len(cpus))})
+	offset := uint32(0x1000)
+	for _, cpu := range cpus {
+		thin := buildMachO(cpu)
+		binary.Write(&header, binary.BigEndian, []uint32{uint32(cpu), 0, offset, uint32(len(thin)), 12})
+		body.Write(make([]byte, int(offset)-8-20*len(cpus)-body.Len()))
+		body.Write(thin)
+		offset += 0x1000
+	}
+	header.Write(body.Bytes())
+	return header.Bytes()
+}
+
+func TestAnalyzeMachO(t *testing.T) {
+	tests := []struct {
+		name    string
+		content []byte
+		arch    string
+	}{
+		{"thin arm64", buildMachO(macho.CpuArm64), "arm64"},
+		{"thin amd64", buildMachO(macho.CpuAmd64), "amd64"},
+		{"universal", buildFat(macho.CpuArm64, macho.CpuAmd64), "arm64,amd64"},
+		{"universal with ppc64", buildFat(macho.CpuAmd64, macho.CpuPpc64), "amd64,ppc64"},
+		{"universal with unknown cpu", buildFat(macho.CpuAmd64, macho.Cpu(0x1000010)), "amd64,16777232"},
+	}
+	for _, tt := range tests {
+		info, err := Analyze(writeFixture(t, tt.content))
+		if err != nil {
+			t.Errorf("%v: %v", tt.name, err)
+			continue
+		}
+		want := &Info{
+			Format:   "macho",
+			Arch:     tt.arch,
+			BuildID:  "01234567-89ab-cdef-0123-456789abcdef",
+			Entry:    "0x100000400",
+			Sections: map[string]string{"__TEXT,__text": sha(machoText)},
+		}
+		if !reflect.DeepEqual(info, want) {
+			t.Errorf("%v: Analyze() = %+v, want %+v", tt.name, info, want)
+		}
+	}
+}
+
+func TestAnalyzeNotBinary(t *testing.T) {
+	dosStub := append([]byte("MZ"), make([]byte, 126)...)
+	binary.LittleEndian.PutUint32(dosStub[0x3c:], 64)
+	copy(dosStub[64:], "NE\x00\x00")
+	outside := append([]byte("MZ"), make([]byte, 62)...)
+	binary.LittleEndian.PutUint32(outside[0x3c:], 0xffff)
+	tests := []struct {
+		name    string
+		content []byte
+	}{
+		{"empty", nil},
+		{"text", []byte("hello world\n")},
+		{"short elf magic", []byte("\x7fEL")},
+		{"MZ text", []byte("MZ hello, this is just a text file starting with MZ\n")},
+		{"long MZ text", bytes.Repeat([]byte("MZ text "), 32)},
+		{"DOS executable", dosStub},
+		{"PE offset outside of file", outside},
+		{"java class", []byte{0xca, 0xfe, 0xba, 0xbe, 0x00, 0x00, 0x00, 0x34, 0x00, 0x0a, 0x07, 0x00, 0x02}},
+		{"old java class", []byte{0xca, 0xfe, 0xba, 0xbe, 0x00, 0x03, 0x00, 0x2d, 0x00, 0x0a}},
+		{"short universal header", []byte{0xca, 0xfe, 0xba, 0xbe, 0x00, 0x00}},
+	}
+	for _, tt := range tests {
+		if info, err := Analyze(writeFixture(t, tt.content)); err != ErrNotBinary {
+			t.Errorf("%v: Analyze() = %+v, %v, want %v", tt.name, info, err, ErrNotBinary)
+		}
+	}
+}
+
+func TestAnalyzeGoBinary(t *testing.T) {
+	formats := map[string]string{"linux": "elf", "windows": "pe", "darwin": "macho"}
+	format, ok := formats[runtime.GOOS]
+	if !ok {
+		t.Skipf("no executable format for %v", runtime.GOOS)
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		t.Skip(err)
+	}
+	info, err := Analyze(exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Format != format || info.Arch != runtime.GOARCH || info.Go == nil || info.Go.Version != runtime.Version() {
+		t.Errorf("Analyze() of the test binary = %+v", info)
+	}
+	if meta := info.Metadata(); meta["go_version"] != runtime.Version() || meta["binary_format"] != format {
+		t.Errorf("Metadata() = %v", meta)
+	}
+}
@@ -0,0 +1,152 @@
+package gitinfo
+
+import (
+	"bytes"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Values of the text attribute
+const (
+	textSet   = "set"
+	textUnset = "unset"
+	textAuto  = "auto"
+)
+
+// binaryCheckSize is the prefix git searches for NUL bytes to detect
+// binary files
+const binaryCheckSize = 8000
+
+// cleanContent returns the content of a worktree file as git would store
+// it: CRLF line endings are converted to LF if the text attribute or
+// core.autocrlf ask for it. Other attributes such as clean filters, ident
+// or working-tree-encoding are not applied.
+func (r *Repo) cleanContent(p string, content []byte) []byte {
+	if !r.convertsEOL(p, content) {
+		return content
+	}
+	return bytes.ReplaceAll(content, []byte("\r\n"), []byte("\n"))
+}
+
+// convertsEOL reports whether line endings of the file are normalized
+// when it is added
+func (r *Repo) convertsEOL(p string, content []byte) bool {
+	switch r.textAttr(p) {
+	case textSet:
+		return true
+	case textUnset:
+		return false
+	case textAuto:
+		return !isBinary(content)
+	}
+	switch strings.ToLower(r.autoCRLF()) {
+	case "true", "yes", "on", "1", "input":
+		return !isBinary(content)
+	}
+	return false
+}
+
+// autoCRLF returns core.autocrlf of the repository or the global config
+func (r *Repo) autoCRLF() string {
+	if value := r.configValue("core.autocrlf"); value != "" {
+		return value
+	}
+	var files []string
+	if xdg := os.Getenv("XDG_CONFIG_HOME"); xdg != "" {
+		files = append(files, filepath.Join(xdg, "git", "config"))
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		if os.Getenv("XDG_CONFIG_HOME") == "" {
+			files = append(files, filepath.Join(home, ".config", "git", "config"))
+		}
+		files = append(files, filepath.Join(home, ".gitconfig"))
+	}
+	value := ""
+	for _, file := range files {
+		values, _ := readConfig(file)
+		for _, kv := range values {
+			if kv[0] == "core.autocrlf" {
+				value = kv[1]
+			}
+		}
+	}
+	return value
+}
+
+// textAttr returns the text attribute of the slash separated path from
+// the .gitattributes files of the worktree and info/attributes: set,
+// unset, auto or empty if unspecified. An eol attribute implies text.
+func (r *Repo) textAttr(p string) string {
+	type attrFile struct{ file, dir string }
+	files := []attrFile{{filepath.Join(r.WorkTree, ".gitattributes"), ""}}
+	dir := ""
+	for _, name := range strings.Split(path.Dir(p), "/") {
+		if name == "." {
+			break
+		}
+		dir = path.Join(dir, name)
+		files = append(files, attrFile{filepath.Join(r.WorkTree, filepath.FromSlash(dir), ".gitattributes"), dir})
+	}
+	files = append(files, attrFile{filepath.Join(r.CommonDir, "info", "attributes"), ""})
+
+	text, eol := "", false
+	for _, f := range files {
+		raw, err := os.ReadFile(f.file)
+		if err != nil {
+			continue
+		}
+		for _, line := range strings.Split(string(raw), "\n") {
+			fields := strings.Fields(line)
+			if len(fields) < 2 || strings.HasPrefix(fields[0], "#") || !matchAttr(f.dir, fields[0], p) {
+				continue
+			}
+			for _, attr := range fields[1:] {
+				switch {
+				case attr == "text":
+					text = textSet
+				case attr == "-text" || attr == "binary":
+					text = textUnset
+				case attr == "text=auto":
+					text = textAuto
+				case attr == "!text":
+					text = ""
+				case strings.HasPrefix(attr, "eol="):
+					eol = true
+				case attr == "-eol" || attr == "!eol":
+					eol = false
+				}
+			}
+		}
+	}
+	if text == "" && eol {
+		return textSet
+	}
+	return text
+}
+
+// matchAttr matches a pattern of the attributes file in dir with the
+// path, patterns without slash match the name in any directory below
+func matchAttr(dir, pattern, p string) bool {
+	rel := p
+	if dir != "" {
+		if !strings.HasPrefix(p, dir+"/") {
+			return false
+		}
+		rel = strings.TrimPrefix(p, dir+"/")
+	}
+	if !strings.Contains(pattern, "/") {
+		rel = path.Base(rel)
+	}
+	ok, _ := path.Match(strings.TrimPrefix(pattern, "/"), rel)
+	return ok
+}
+
+// isBinary detects binary content by a NUL byte like git
+func isBinary(content []byte) bool {
+	if len(content) > binaryCheckSize {
+		content = content[:binaryCheckSize]
+	}
+	return bytes.IndexByte(content, 0) >= 0
+}
@@ -0,0 +1,363 @@
+package gitinfo
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Object types
+const (
+	TypeCommit = "commit"
+	TypeTree   = "tree"
+	TypeBlob   = "blob"
+	TypeTag    = "tag"
+)
+
+// packTypes maps the type ids of pack entries
+var packTypes = map[byte]string{1: TypeCommit, 2: TypeTree, 3: TypeBlob, 4: TypeTag}
+
+const (
+	packOfsDelta = 6
+	packRefDelta = 7
+	maxCached    = 256
+)
+
+// ErrObjectNotFound is returned for missing objects
+var ErrObjectNotFound = errors.New("object not found")
+
+type object struct {
+	typ  string
+	data []byte
+}
+
+// objectStore reads loose and packed objects
+type objectStore struct {
+	dir   string
+	packs []*pack
+	init  bool
+	cache map[string]*object
+}
+
+// pack is a packfile with its version 2 index
+type pack struct {
+	path    string
+	fanout  [256]uint32
+	ids     []byte
+	offsets []uint32
+	large   []byte
+}
+
+// read returns the object with the hex id
+func (s *objectStore) read(id string) (*object, error) {
+	if obj, ok := s.cache[id]; ok {
+		return obj, nil
+	}
+	obj, err := s.readLoose(id)
+	if errors.Is(err, os.ErrNotExist) {
+		obj, err = s.readPacked(id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(s.cache) >= maxCached {
+		s.cache = map[string]*object{}
+	}
+	s.cache[id] = obj
+	return obj, nil
+}
+
+// readLoose reads a zlib compressed object file
+func (s *objectStore) readLoose(id string) (*object, error) {
+	if len(id) < 3 {
+		return nil, ErrObjectNotFound
+	}
+	f, err := os.Open(filepath.Join(s.dir, id[:2], id[2:]))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	zr, err := zlib.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	raw, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, err
+	}
+	header, data, ok := bytes.Cut(raw, []byte{0})
+	if !ok {
+		return nil, fmt.Errorf("invalid object %v", id)
+	}
+	typ, size, _ := strings.Cut(string(header), " ")
+	if n, err := strconv.Atoi(size); err != nil || n != len(data) {
+		return nil, fmt.Errorf("invalid object %v", id)
+	}
+	return &object{typ: typ, data: data}, nil
+}
+
+// readPacked searches the object in all packs
+func (s *objectStore) readPacked(id string) (*object, error) {
+	if !s.init {
+		s.init = true
+		matches, _ := filepath.Glob(filepath.Join(s.dir, "pack", "*.idx"))
+		for _, idx := range matches {
+			p, err := openPack(idx)
+			if err != nil {
+				continue
+			}
+			s.packs = append(s.packs, p)
+		}
+	}
+	raw, err := hex.DecodeString(id)
+	if err != nil || len(raw) != 20 {
+		return nil, ErrObjectNotFound
+	}
+	for _, p := range s.packs {
+		if offset, ok := p.find(raw); ok {
+			return s.readPackEntry(p, offset)
+		}
+	}
+	return nil, ErrObjectNotFound
+}
+
+// openPack reads the index of a pack
+func openPack(idxPath string) (*pack, error) {
+	raw, err := os.ReadFile(idxPath)
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) < 8+256*4 || !bytes.Equal(raw[:4], []byte{0xff, 't', 'O', 'c'}) || binary.BigEndian.Uint32(raw[4:8]) != 2 {
+		return nil, fmt.Errorf("unsupported pack index %v", idxPath)
+	}
+	p := &pack{path: strings.TrimSuffix(idxPath, ".idx") + ".pack"}
+	for i := range p.fanout {
+		p.fanout[i] = binary.BigEndian.Uint32(raw[8+i*4:])
+	}
+	n := int(p.fanout[255])
+	pos := 8 + 256*4
+	if len(raw) < pos+n*(20+4+4) {
+		return nil, fmt.Errorf("truncated pack index %v", idxPath)
+	}
+	p.ids = raw[pos : pos+n*20]
+	pos += n*20 + n*4 // skip crc32
+	p.offsets = make([]uint32, n)
+	for i := range p.offsets {
+		p.offsets[i] = binary.BigEndian.Uint32(raw[pos+i*4:])
+	}
+	p.large = raw[pos+n*4:]
+	return p, nil
+}
+
+// find returns the offset of the object id in the pack
+func (p *pack) find(id []byte) (int64, bool) {
+	lo := 0
+	if id[0] > 0 {
+		lo = int(p.fanout[id[0]-1])
+	}
+	hi := int(p.fanout[id[0]])
+	for lo < hi {
+		mid := (lo + hi) / 2
+		switch c := bytes.Compare(p.ids[mid*20:mid*20+20], id); {
+		case c == 0:
+			offset := p.offsets[mid]
+			if offset&0x80000000 == 0 {
+				return int64(offset), true
+			}
+			i := int(offset&0x7fffffff) * 8
+			if i+8 > len(p.large) {
+				return 0, false
+			}
+			return int64(binary.BigEndian.Uint64(p.large[i:])), true
+		case c < 0:
+			lo = mid + 1
+		default:
+			hi = mid
+		}
+	}
+	return 0, false
+}
+
+// readPackEntry reads and, for deltas, reconstructs the object at offset
+func (s *objectStore) readPackEntry(p *pack, offset int64) (*object, error) {
+	f, err := os.Open(p.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return s.readPackEntryFrom(f, p, offset, 0)
+}
+
+func (s *objectStore) readPackEntryFrom(f *os.File, p *pack, offset int64, depth int) (*object, error) {
+	if depth > 50 {
+		return nil, fmt.Errorf("delta chain too long in %v", p.path)
+	}
+	r := &byteReader{r: io.NewSectionReader(f, offset, 1<<62)}
+
+	// Type and size header
+	b, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	typ := (b >> 4) & 7
+	for b&0x80 != 0 {
+		if b, err = r.ReadByte(); err != nil {
+			return nil, err
+		}
+	}
+
+	// Base of deltas
+	var base *object
+	switch typ {
+	case packOfsDelta:
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		rel := int64(b & 0x7f)
+		for b&0x80 != 0 {
+			if b, err = r.ReadByte(); err != nil {
+				return nil, err
+			}
+			rel = ((rel + 1) << 7) | int64(b&0x7f)
+		}
+		if base, err = s.readPackEntryFrom(f, p, offset-rel, depth+1); err != nil {
+			return nil, err
+		}
+	case packRefDelta:
+		id := make([]byte, 20)
+		if _, err := io.ReadFull(r, id); err != nil {
+			return nil, err
+		}
+		if base, err = s.read(hex.EncodeToString(id)); err != nil {
+			return nil, err
+		}
+	}
+
+	zr, err := zlib.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, err
+	}
+	if base == nil {
+		name, ok := packTypes[typ]
+		if !ok {
+			return nil, fmt.Errorf("unknown object type %v in %v", typ, p.path)
+		}
+		return &object{typ: name, data: data}, nil
+	}
+	patched, err := applyDelta(base.data, data)
+	if err != nil {
+		return nil, err
+	}
+	return &object{typ: base.typ, data: patched}, nil
+}
+
+// applyDelta reconstructs an object from its base and a delta
+func applyDelta(base, delta []byte) ([]byte, error) {
+	pos := 0
+	varint := func() (int, error) {
+		n, shift := 0, 0
+		for {
+			if pos >= len(delta) {
+				return 0, fmt.Errorf("truncated delta")
+			}
+			b := delta[pos]
+			pos++
+			n |= int(b&0x7f) << shift
+			shift += 7
+			if b&0x80 == 0 {
+				return n, nil
+			}
+		}
+	}
+	srcSize, err := varint()
+	if err != nil {
+		return nil, err
+	}
+	if srcSize != len(base) {
+		return nil, fmt.Errorf("delta base size mismatch")
+	}
+	dstSize, err := varint()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, 0, dstSize)
+	for pos < len(delta) {
+		op := delta[pos]
+		pos++
+		if op&0x80 == 0 {
+			// Insert
+			n := int(op)
+			if n == 0 || pos+n > len(delta) {
+				return nil, fmt.Errorf("invalid delta insert")
+			}
+			out = append(out, delta[pos:pos+n]...)
+			pos += n
+			continue
+		}
+
+		// Copy from base
+		var offset, size int
+		for i := 0; i < 4; i++ {
+			if op&(1<<i) != 0 {
+				if pos >= len(delta) {
+					return nil, fmt.Errorf("truncated delta")
+				}
+				offset |= int(delta[pos]) << (8 * i)
+				pos++
+			}
+		}
+		for i := 0; i < 3; i++ {
+			if op&(1<<(4+i)) != 0 {
+				if pos >= len(delta) {
+					return nil, fmt.Errorf("truncated delta")
+				}
+				size |= int(delta[pos]) << (8 * i)
+				pos++
+			}
+		}
+		if size == 0 {
+			size = 0x10000
+		}
+		if offset+size > len(base) {
+			return nil, fmt.Errorf("invalid delta copy")
+		}
+		out = append(out, base[offset:offset+size]...)
+	}
+	if len(out) != dstSize {
+		return nil, fmt.Errorf("delta result size mismatch")
+	}
+	return out, nil
+}
+
+// byteReader adds ReadByte to a reader, so zlib does not read ahead
+// through a bufio.Reader and the position stays exact
+type byteReader struct {
+	r   io.Reader
+	buf [1]byte
+}
+
+func (b *byteReader) Read(p []byte) (int, error) {
+	return b.r.Read(p)
+}
+
+func (b *byteReader) ReadByte() (byte, error) {
+	if _, err := io.ReadFull(b.r, b.buf[:]); err != nil {
+		return 0, err
+	}
+	return b.buf[0], nil
+}
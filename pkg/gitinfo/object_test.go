@@ -0,0 +1,138 @@
+package gitinfo
+
+import (
+	"bytes"
+	"compress/zlib"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestApplyDelta(t *testing.T) {
+	base := []byte("hello world")
+	tests := []struct {
+		name  string
+		delta []byte
+		want  string
+		err   bool
+	}{
+		// copy offset 0 size 6, insert "git"
+		{"copy and insert", []byte{11, 9, 0x90, 6, 3, 'g', 'i', 't'}, "hello git", false},
+		// copy offset 6 size 5 with offset byte
+		{"copy with offset", []byte{11, 5, 0x91, 6, 5}, "world", false},
+		{"insert only", []byte{11, 2, 2, 'o', 'k'}, "ok", false},
+		{"base size mismatch", []byte{12, 2, 2, 'o', 'k'}, "", true},
+		{"result size mismatch", []byte{11, 3, 2, 'o', 'k'}, "", true},
+		{"copy beyond base", []byte{11, 5, 0x91, 8, 5}, "", true},
+		{"truncated insert", []byte{11, 3, 3, 'o', 'k'}, "", true},
+		{"truncated copy", []byte{11, 5, 0x91}, "", true},
+		{"truncated header", []byte{0x8b}, "", true},
+	}
+	for _, tt := range tests {
+		got, err := applyDelta(base, tt.delta)
+		if (err != nil) != tt.err {
+			t.Errorf("%v: applyDelta() error %v, want error %v", tt.name, err, tt.err)
+			continue
+		}
+		if string(got) != tt.want {
+			t.Errorf("%v: applyDelta() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+// writeLoose stores a raw loose object below dir
+func writeLoose(t *testing.T, dir, id string, raw []byte) {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	zw.Write(raw)
+	zw.Close()
+	if err := os.MkdirAll(filepath.Join(dir, id[:2]), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, id[:2], id[2:]), buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReadLoose(t *testing.T) {
+	dir := t.TempDir()
+	id := BlobID([]byte("hello\n"))
+	writeLoose(t, dir, id, []byte("blob 6\x00hello\n"))
+	writeLoose(t, dir, "aa00000000000000000000000000000000000000", []byte("blob 7\x00hello\n"))
+	writeLoose(t, dir, "bb00000000000000000000000000000000000000", []byte("blob 6 hello\n"))
+
+	s := &objectStore{dir: dir, cache: map[string]*object{}}
+	obj, err := s.read(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if obj.typ != TypeBlob || string(obj.data) != "hello\n" {
+		t.Errorf("read() = %v %q", obj.typ, obj.data)
+	}
+	for _, invalid := range []string{"aa00000000000000000000000000000000000000", "bb00000000000000000000000000000000000000"} {
+		if _, err := s.read(invalid); err == nil {
+			t.Errorf("read(%v) succeeded, want error", invalid)
+		}
+	}
+	if _, err := s.read("cc00000000000000000000000000000000000000"); err != ErrObjectNotFound {
+		t.Errorf("read() of missing object: %v, want %v", err, ErrObjectNotFound)
+	}
+}
+
+func TestReadCommit(t *testing.T) {
+	tree := "4b825dc642cb6eb9a060e54bf8d69288fbee4904"
+	r := &Repo{objects: &objectStore{cache: map[string]*object{
+		"merge": {TypeCommit, []byte("tree " + tree + "\nparent p1\nparent p2\nauthor a <a> 0 +0000\n\nparent p3\n")},
+		"root":  {TypeCommit, []byte("tree " + tree + "\nauthor a <a> 0 +0000\n\nmessage\n")},
+		"empty": {TypeCommit, []byte("author a <a> 0 +0000\n\nmessage\n")},
+		"blob":  {TypeBlob, []byte("tree " + tree + "\n")},
+	}}}
+	tests := []struct {
+		id      string
+		parents []string
+		err     bool
+	}{
+		{"merge", []string{"p1", "p2"}, false},
+		{"root", nil, false},
+		{"empty", nil, true},
+		{"blob", nil, true},
+	}
+	for _, tt := range tests {
+		gotTree, parents, err := r.readCommit(tt.id)
+		if (err != nil) != tt.err {
+			t.Errorf("readCommit(%v) error %v, want error %v", tt.id, err, tt.err)
+			continue
+		}
+		if !tt.err && (gotTree != tree || !reflect.DeepEqual(parents, tt.parents)) {
+			t.Errorf("readCommit(%v) = %v %v, want %v %v", tt.id, gotTree, parents, tree, tt.parents)
+		}
+	}
+}
+
+func TestTreeEntry(t *testing.T) {
+	id := bytes.Repeat([]byte{0xab}, 20)
+	data := append([]byte("100644 a.txt\x00"), id...)
+	data = append(data, []byte("40000 dir\x00")...)
+	data = append(data, id...)
+	r := &Repo{objects: &objectStore{cache: map[string]*object{
+		"tree":      {TypeTree, data},
+		"truncated": {TypeTree, []byte("100644 a.txt\x00abc")},
+	}}}
+	tests := []struct {
+		tree, name, mode, id string
+		err                  bool
+	}{
+		{"tree", "a.txt", "100644", "abababababababababababababababababababab", false},
+		{"tree", "dir", "40000", "abababababababababababababababababababab", false},
+		{"tree", "missing", "", "", false},
+		{"truncated", "a.txt", "", "", true},
+	}
+	for _, tt := range tests {
+		mode, id, err := r.treeEntry(tt.tree, tt.name)
+		if (err != nil) != tt.err || mode != tt.mode || id != tt.id {
+			t.Errorf("treeEntry(%v, %v) = %v %v %v, want %v %v error %v", tt.tree, tt.name, mode, id, err, tt.mode, tt.id, tt.err)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package gitinfo
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// MaxHistory limits the commits searched for the last commit of a file
+var MaxHistory = 1000
+
+// Provenance describes where a file comes from
+type Provenance struct {
+	Remote     string // url of the remote, without credentials
+	Commit     string // commit of HEAD
+	Branch     string // checked out branch, empty if detached
+	Path       string // slash separated path within the repository
+	Tracked    bool   // file is part of the HEAD commit
+	Dirty      bool   // file differs from the HEAD commit or is untracked, see cleanContent
+	LastCommit string // last commit of the first parent history changing the file
+}
+
+// FileProvenance returns the provenance of a file, ErrNotRepository is
+// returned for files outside of a git checkout
+func FileProvenance(path string) (*Provenance, error) {
+	r, err := Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return r.Provenance(path)
+}
+
+// Provenance returns the provenance of a file in the repository
+func (r *Repo) Provenance(path string) (*Provenance, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	if resolved, err := filepath.EvalSymlinks(abs); err == nil {
+		abs = resolved
+	}
+	workTree := r.WorkTree
+	if resolved, err := filepath.EvalSymlinks(workTree); err == nil {
+		workTree = resolved
+	}
+	rel, err := filepath.Rel(workTree, abs)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return nil, fmt.Errorf("%v is not within %v", path, r.WorkTree)
+	}
+
+	p := &Provenance{Path: filepath.ToSlash(rel), Dirty: true}
+	if p.Commit, p.Branch, err = r.Head(); err != nil {
+		return nil, err
+	}
+	p.Remote = r.RemoteURL(p.Branch)
+	if p.Commit == "" {
+		return p, nil
+	}
+	if format := r.configValue("extensions.objectformat"); format != "" && format != "sha1" {
+		return p, fmt.Errorf("object format %v is not supported", format)
+	}
+
+	// Compare with the committed version
+	blob, err := r.blobAt(p.Commit, p.Path)
+	if err != nil {
+		return p, err
+	}
+	if blob == "" {
+		return p, nil
+	}
+	p.Tracked = true
+	content, err := os.ReadFile(abs)
+	if err != nil {
+		return p, err
+	}
+	p.Dirty = BlobID(content) != blob && BlobID(r.cleanContent(p.Path, content)) != blob
+	p.LastCommit, err = r.lastCommit(p.Commit, p.Path, blob)
+	return p, err
+}
+
+// BlobID returns the object id of content stored as blob
+func BlobID(content []byte) string {
+	h := sha1.New()
+	fmt.Fprintf(h, "%v %v\x00", TypeBlob, len(content))
+	h.Write(content)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// lastCommit follows the first parents of commit as long as the file is
+// unchanged and returns the commit which introduced blob
+func (r *Repo) lastCommit(commit, path, blob string) (string, error) {
+	for i := 0; i < MaxHistory; i++ {
+		_, parents, err := r.readCommit(commit)
+		if err != nil {
+			return "", err
+		}
+		if len(parents) == 0 {
+			return commit, nil
+		}
+		parentBlob, err := r.blobAt(parents[0], path)
+		if err != nil {
+			return "", err
+		}
+		if parentBlob != blob {
+			return commit, nil
+		}
+		commit = parents[0]
+	}
+	return "", fmt.Errorf("no change of %v within %v commits", path, MaxHistory)
+}
+
+// blobAt returns the blob id of path in the tree of commit, empty if the
+// path does not exist
+func (r *Repo) blobAt(commit, path string) (string, error) {
+	tree, _, err := r.readCommit(commit)
+	if err != nil {
+		return "", err
+	}
+	parts := strings.Split(path, "/")
+	for i, name := range parts {
+		mode, id, err := r.treeEntry(tree, name)
+		if err != nil || id == "" {
+			return "", err
+		}
+		isTree := mode == "40000"
+		if i == len(parts)-1 {
+			if isTree {
+				return "", nil
+			}
+			return id, nil
+		}
+		if !isTree {
+			return "", nil
+		}
+		tree = id
+	}
+	return "", nil
+}
+
+// readCommit returns the tree and the parents of a commit
+func (r *Repo) readCommit(id string) (tree string, parents []string, err error) {
+	obj, err := r.objects.read(id)
+	if err != nil {
+		return "", nil, fmt.Errorf("could not read commit %v: %v", id, err)
+	}
+	if obj.typ != TypeCommit {
+		return "", nil, fmt.Errorf("%v is a %v, not a commit", id, obj.typ)
+	}
+	header, _, _ := bytes.Cut(obj.data, []byte("\n\n"))
+	for _, line := range strings.Split(string(header), "\n") {
+		key, value, _ := strings.Cut(line, " ")
+		switch key {
+		case "tree":
+			tree = value
+		case "parent":
+			parents = append(parents, value)
+		}
+	}
+	if tree == "" {
+		return "", nil, fmt.Errorf("commit %v has no tree", id)
+	}
+	return tree, parents, nil
+}
+
+// treeEntry returns the mode and id of an entry of a tree, the id is
+// empty if the entry does not exist
+func (r *Repo) treeEntry(tree, name string) (mode, id string, err error) {
+	obj, err := r.objects.read(tree)
+	if err != nil {
+		return "", "", fmt.Errorf("could not read tree %v: %v", tree, err)
+	}
+	if obj.typ != TypeTree {
+		return "", "", fmt.Errorf("%v is a %v, not a tree", tree, obj.typ)
+	}
+	data := obj.data
+	for len(data) > 0 {
+		header, rest, ok := bytes.Cut(data, []byte{0})
+		if !ok || len(rest) < 20 {
+			return "", "", fmt.Errorf("invalid tree %v", tree)
+		}
+		entryMode, entryName, _ := strings.Cut(string(header), " ")
+		if entryName == name {
+			return entryMode, hex.EncodeToString(rest[:20]), nil
+		}
+		data = rest[20:]
+	}
+	return "", "", nil
+}
@@ -0,0 +1,250 @@
+// Package gitinfo reads provenance information of files in a git
+// checkout directly from the .git directory, without the git binary.
+//
+// It resolves HEAD, loose and packed refs, the remotes of the config and
+// reads loose and packed objects (including deltas) to compare a file
+// with its committed version and to find the last commit touching it.
+// Only SHA-1 repositories are supported for object access.
+package gitinfo
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrNotRepository is returned if no .git is found above a path
+var ErrNotRepository = errors.New("not in a git repository")
+
+// Repo is a git checkout
+type Repo struct {
+	WorkTree  string // root of the checkout
+	GitDir    string // .git directory of the checkout (worktree specific)
+	CommonDir string // directory with objects, refs and config
+
+	objects *objectStore
+}
+
+// Open finds the repository containing path by searching .git upwards
+func Open(path string) (*Repo, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	dir := abs
+	if info, err := os.Stat(abs); err == nil && !info.IsDir() {
+		dir = filepath.Dir(abs)
+	}
+	for {
+		dotGit := filepath.Join(dir, ".git")
+		if info, err := os.Stat(dotGit); err == nil {
+			gitDir := dotGit
+			if !info.IsDir() {
+				if gitDir, err = readGitFile(dotGit); err != nil {
+					return nil, err
+				}
+			}
+			return newRepo(dir, gitDir)
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil, ErrNotRepository
+		}
+		dir = parent
+	}
+}
+
+// readGitFile resolves a .git file of worktrees and submodules
+func readGitFile(path string) (string, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	line := strings.TrimSpace(string(raw))
+	if !strings.HasPrefix(line, "gitdir:") {
+		return "", fmt.Errorf("invalid .git file %v", path)
+	}
+	gitDir := strings.TrimSpace(strings.TrimPrefix(line, "gitdir:"))
+	if !filepath.IsAbs(gitDir) {
+		gitDir = filepath.Join(filepath.Dir(path), gitDir)
+	}
+	return filepath.Clean(gitDir), nil
+}
+
+func newRepo(workTree, gitDir string) (*Repo, error) {
+	r := &Repo{WorkTree: workTree, GitDir: gitDir, CommonDir: gitDir}
+	if raw, err := os.ReadFile(filepath.Join(gitDir, "commondir")); err == nil {
+		common := strings.TrimSpace(string(raw))
+		if !filepath.IsAbs(common) {
+			common = filepath.Join(gitDir, common)
+		}
+		r.CommonDir = filepath.Clean(common)
+	}
+	if _, err := os.Stat(filepath.Join(r.GitDir, "HEAD")); err != nil {
+		return nil, fmt.Errorf("invalid git directory %v: %v", r.GitDir, err)
+	}
+	r.objects = &objectStore{dir: filepath.Join(r.CommonDir, "objects"), cache: map[string]*object{}}
+	return r, nil
+}
+
+// Head returns the commit id of HEAD and the branch name, the branch is
+// empty for a detached HEAD
+func (r *Repo) Head() (commit, branch string, err error) {
+	raw, err := os.ReadFile(filepath.Join(r.GitDir, "HEAD"))
+	if err != nil {
+		return "", "", err
+	}
+	head := strings.TrimSpace(string(raw))
+	if !strings.HasPrefix(head, "ref:") {
+		return head, "", nil
+	}
+	ref := strings.TrimSpace(strings.TrimPrefix(head, "ref:"))
+	branch = strings.TrimPrefix(ref, "refs/heads/")
+	commit, err = r.ResolveRef(ref)
+	return commit, branch, err
+}
+
+// ResolveRef returns the commit id of a loose or packed ref, an empty id
+// is returned for a branch without commits
+func (r *Repo) ResolveRef(ref string) (string, error) {
+	for i := 0; i < 10; i++ {
+		value, ok := r.looseRef(ref)
+		if !ok {
+			return r.packedRef(ref)
+		}
+		if !strings.HasPrefix(value, "ref:") {
+			return value, nil
+		}
+		ref = strings.TrimSpace(strings.TrimPrefix(value, "ref:"))
+	}
+	return "", fmt.Errorf("too many symbolic refs for %v", ref)
+}
+
+// looseRef reads a ref file of the worktree or the common directory
+func (r *Repo) looseRef(ref string) (string, bool) {
+	for _, dir := range []string{r.GitDir, r.CommonDir} {
+		if raw, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(ref))); err == nil {
+			return strings.TrimSpace(string(raw)), true
+		}
+	}
+	return "", false
+}
+
+// packedRef looks up the ref in packed-refs
+func (r *Repo) packedRef(ref string) (string, error) {
+	f, err := os.Open(filepath.Join(r.CommonDir, "packed-refs"))
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "#") || strings.HasPrefix(line, "^") {
+			continue
+		}
+		if id, name, ok := strings.Cut(line, " "); ok && name == ref {
+			return id, nil
+		}
+	}
+	return "", scanner.Err()
+}
+
+// config returns the values of the git config as section.subsection.key,
+// e.g. remote.origin.url, in the order of the file
+func (r *Repo) config() ([][2]string, error) {
+	return readConfig(filepath.Join(r.CommonDir, "config"))
+}
+
+// readConfig parses a git config file
+func readConfig(path string) ([][2]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var values [][2]string
+	section := ""
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";"):
+		case strings.HasPrefix(line, "["):
+			header := strings.Trim(line, "[]")
+			name, sub, hasSub := strings.Cut(header, " ")
+			section = strings.ToLower(name)
+			if hasSub {
+				section += "." + strings.Trim(strings.TrimSpace(sub), `"`)
+			}
+		default:
+			key, value, _ := strings.Cut(line, "=")
+			values = append(values, [2]string{section + "." + strings.ToLower(strings.TrimSpace(key)), strings.Trim(strings.TrimSpace(value), `"`)})
+		}
+	}
+	return values, scanner.Err()
+}
+
+// configValue returns the last value of the key
+func (r *Repo) configValue(key string) string {
+	values, _ := r.config()
+	value := ""
+	for _, kv := range values {
+		if kv[0] == key {
+			value = kv[1]
+		}
+	}
+	return value
+}
+
+// RemoteURL returns the url of the remote of the branch, of origin or of
+// the first remote without credentials
+func (r *Repo) RemoteURL(branch string) string {
+	values, err := r.config()
+	if err != nil {
+		return ""
+	}
+	remote := ""
+	if branch != "" {
+		remote = r.configValue("branch." + branch + ".remote")
+	}
+	urls := map[string]string{}
+	first := ""
+	for _, kv := range values {
+		if strings.HasPrefix(kv[0], "remote.") && strings.HasSuffix(kv[0], ".url") {
+			name := strings.TrimSuffix(strings.TrimPrefix(kv[0], "remote."), ".url")
+			urls[name] = kv[1]
+			if first == "" {
+				first = name
+			}
+		}
+	}
+	for _, name := range []string{remote, "origin", first} {
+		if u, ok := urls[name]; ok && name != "" {
+			return StripCredentials(u)
+		}
+	}
+	return ""
+}
+
+// StripCredentials removes the user info of http(s) URLs, which often
+// holds a token instead of a user name, and passwords of other URLs.
+// scp-like remotes such as git@host:path are kept.
+func StripCredentials(remote string) string {
+	u, err := url.Parse(remote)
+	if err != nil || u.User == nil || u.Scheme == "" {
+		return remote
+	}
+	_, hasPassword := u.User.Password()
+	if u.Scheme == "http" || u.Scheme == "https" || hasPassword {
+		u.User = nil
+	}
+	return u.String()
+}
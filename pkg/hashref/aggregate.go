@@ -0,0 +1,113 @@
+package hashref
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+)
+
+// aggregateIgnoredKeys are expected to differ between publishers and
+// are not considered for the consensus
+var aggregateIgnoredKeys = map[string]bool{"last_published": true}
+
+// Aggregation groups the metadata of a lookup per publisher and shows
+// where the publishers agree or disagree
+type Aggregation struct {
+	Publishers map[string]map[string]interface{} `json:"publishers" yaml:"publishers"`
+	Consensus  map[string]KeyConsensus           `json:"consensus" yaml:"consensus"`
+	Conflicts  []string                          `json:"conflicts" yaml:"conflicts"`
+}
+
+// KeyConsensus describes the values of a metadata key over all
+// publishers. Every publisher is weighted by its trust level, see
+// publisherWeight.
+type KeyConsensus struct {
+	Value     interface{}    `json:"value" yaml:"value"`
+	Agreement float64        `json:"agreement" yaml:"agreement"`
+	Conflict  bool           `json:"conflict" yaml:"conflict"`
+	Values    []ValueSupport `json:"values" yaml:"values"`
+}
+
+// ValueSupport lists the publishers that claim a value
+type ValueSupport struct {
+	Value      interface{} `json:"value" yaml:"value"`
+	Publishers []string    `json:"publishers" yaml:"publishers"`
+	Weight     int         `json:"weight" yaml:"weight"`
+}
+
+// Aggregate computes the consensus per metadata key over all publishers
+// of the metadata. The value with the highest weight is the consensus,
+// a key is a conflict if publishers claim different values.
+func Aggregate(meta map[string]interface{}) *Aggregation {
+	entries := PublisherEntries(meta)
+	agg := &Aggregation{
+		Publishers: entries,
+		Consensus:  map[string]KeyConsensus{},
+		Conflicts:  []string{},
+	}
+
+	// Collect the claimed values per key
+	support := map[string]map[string]*ValueSupport{}
+	for publisher, entry := range entries {
+		weight := publisherWeight(entry)
+		for key, value := range entry {
+			if strings.HasPrefix(key, "_") || aggregateIgnoredKeys[key] {
+				continue
+			}
+			b, _ := json.Marshal(value)
+			if support[key] == nil {
+				support[key] = map[string]*ValueSupport{}
+			}
+			vs, ok := support[key][string(b)]
+			if !ok {
+				vs = &ValueSupport{Value: value}
+				support[key][string(b)] = vs
+			}
+			vs.Publishers = append(vs.Publishers, publisher)
+			vs.Weight += weight
+		}
+	}
+
+	// Decide per key
+	for key, values := range support {
+		kc := KeyConsensus{Conflict: len(values) > 1}
+		total := 0
+		for _, vs := range values {
+			sort.Strings(vs.Publishers)
+			kc.Values = append(kc.Values, *vs)
+			total += vs.Weight
+		}
+		sort.Slice(kc.Values, func(i, j int) bool {
+			if kc.Values[i].Weight != kc.Values[j].Weight {
+				return kc.Values[i].Weight > kc.Values[j].Weight
+			}
+			return kc.Values[i].Publishers[0] < kc.Values[j].Publishers[0]
+		})
+		kc.Value = kc.Values[0].Value
+		if total > 0 {
+			kc.Agreement = float64(kc.Values[0].Weight) / float64(total)
+		}
+		agg.Consensus[key] = kc
+		if kc.Conflict {
+			agg.Conflicts = append(agg.Conflicts, key)
+		}
+	}
+	sort.Strings(agg.Conflicts)
+	return agg
+}
+
+// publisherWeight returns the trust level of a trusted publisher, at
+// least 1, 0 for untrusted publishers and 1 if trust is not configured
+func publisherWeight(entry map[string]interface{}) int {
+	trust, ok := entry[TrustKey].(map[string]interface{})
+	if !ok {
+		return 1
+	}
+	if trust["trusted"] != true {
+		return 0
+	}
+	if level, ok := trust["level"].(int); ok && level > 1 {
+		return level
+	}
+	return 1
+}
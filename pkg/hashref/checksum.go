@@ -0,0 +1,101 @@
+package hashref
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/NodyHub/hashref/pkg/util"
+)
+
+const StatusMismatch Status = "mismatch"
+
+// ChecksumEntry is a single line of a checksum file
+type ChecksumEntry struct {
+	Path string
+	Hash string
+}
+
+// bsdChecksumLine matches the BSD format: SHA256 (file) = hash
+var bsdChecksumLine = regexp.MustCompile(`^SHA256 \((.*)\) ?= ?([0-9a-fA-F]{64})$`)
+
+// ParseChecksumFile reads sha256sum compatible checksum files in GNU
+// ("hash  file" or "hash *file") and BSD ("SHA256 (file) = hash") format.
+// A file with a single hash and without a name, e.g. file.sha256, refers
+// to the file next to it without the extension.
+func ParseChecksumFile(path string) ([]ChecksumEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []ChecksumEntry
+	scanner := bufio.NewScanner(f)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		// BSD format
+		if m := bsdChecksumLine.FindStringSubmatch(line); m != nil {
+			entries = append(entries, ChecksumEntry{Path: m[1], Hash: strings.ToLower(m[2])})
+			continue
+		}
+
+		// GNU format, a leading backslash marks an escaped file name
+		escaped := strings.HasPrefix(line, "\\")
+		if escaped {
+			line = line[1:]
+		}
+		hash, name, _ := strings.Cut(line, " ")
+		if !util.IsPropperHash(hash) {
+			return nil, fmt.Errorf("%v:%v: no sha256 checksum line", path, lineNo)
+		}
+		name = strings.TrimPrefix(strings.TrimPrefix(name, " "), "*")
+		if escaped {
+			name = strings.NewReplacer(`\\`, `\`, `\n`, "\n").Replace(name)
+		}
+		if name == "" {
+			name = strings.TrimSuffix(path, filepath.Ext(path))
+		}
+		entries = append(entries, ChecksumEntry{Path: name, Hash: strings.ToLower(hash)})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	log.Printf("Loaded %v checksums from %v\n", len(entries), path)
+	return entries, nil
+}
+
+// VerifyChecksums hashes the files of the entries and returns a result
+// per entry with the status unchanged, mismatch or missing. The hash of
+// the result is always the expected hash.
+func VerifyChecksums(entries []ChecksumEntry) []Result {
+	results := make([]Result, 0, len(entries))
+	for _, entry := range entries {
+		r := Result{
+			Input:  entry.Path,
+			Type:   Lookup[File],
+			Hash:   entry.Hash,
+			Status: StatusUnchanged,
+		}
+		inputType, actual := GetHashTypeAndValue(entry.Path)
+		switch {
+		case inputType != File:
+			r.Status = StatusMissing
+		case actual != entry.Hash:
+			r.Status = StatusMismatch
+			r.Error = fmt.Sprintf("computed %v", actual)
+		}
+		results = append(results, r)
+	}
+	return results
+}
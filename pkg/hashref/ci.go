@@ -0,0 +1,187 @@
+package hashref
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/NodyHub/hashref/pkg/gitinfo"
+)
+
+// CIInfo is the normalised build information of a CI system
+type CIInfo struct {
+	System     string // github-actions, gitlab-ci, jenkins, buildkite or drone
+	PipelineID string // id of the pipeline or build
+	JobURL     string // link to the job or build
+	Ref        string // git ref, e.g. refs/heads/main or refs/tags/v1.0.0
+	Commit     string // commit built
+	Runner     string // name of the runner or agent
+	Repository string // url of the repository
+}
+
+// ciSystem detects a CI system from the environment
+type ciSystem struct {
+	name   string
+	detect func(env func(string) string) bool
+	info   func(env func(string) string) CIInfo
+}
+
+// ciSystems are the supported CI systems
+var ciSystems = []ciSystem{
+	{
+		name:   "github-actions",
+		detect: func(env func(string) string) bool { return env("GITHUB_ACTIONS") == "true" },
+		info: func(env func(string) string) CIInfo {
+			repo := joinURL(env("GITHUB_SERVER_URL"), env("GITHUB_REPOSITORY"))
+			jobURL := ""
+			if repo != "" && env("GITHUB_RUN_ID") != "" {
+				jobURL = fmt.Sprintf("%v/actions/runs/%v", repo, env("GITHUB_RUN_ID"))
+				if attempt := env("GITHUB_RUN_ATTEMPT"); attempt != "" && attempt != "1" {
+					jobURL += "/attempts/" + attempt
+				}
+			}
+			return CIInfo{
+				PipelineID: env("GITHUB_RUN_ID"),
+				JobURL:     jobURL,
+				Ref:        env("GITHUB_REF"),
+				Commit:     env("GITHUB_SHA"),
+				Runner:     env("RUNNER_NAME"),
+				Repository: repo,
+			}
+		},
+	},
+	{
+		name:   "gitlab-ci",
+		detect: func(env func(string) string) bool { return env("GITLAB_CI") != "" },
+		info: func(env func(string) string) CIInfo {
+			ref := env("CI_MERGE_REQUEST_REF_PATH")
+			if ref == "" {
+				ref = normaliseRef(env("CI_COMMIT_TAG"), env("CI_COMMIT_REF_NAME"))
+			}
+			return CIInfo{
+				PipelineID: env("CI_PIPELINE_ID"),
+				JobURL:     env("CI_JOB_URL"),
+				Ref:        ref,
+				Commit:     env("CI_COMMIT_SHA"),
+				Runner:     firstNonEmpty(env("CI_RUNNER_DESCRIPTION"), env("CI_RUNNER_ID")),
+				Repository: env("CI_PROJECT_URL"),
+			}
+		},
+	},
+	{
+		name:   "jenkins",
+		detect: func(env func(string) string) bool { return env("JENKINS_URL") != "" },
+		info: func(env func(string) string) CIInfo {
+			branch := env("GIT_BRANCH")
+			if i := strings.Index(branch, "/"); i > 0 && !strings.HasPrefix(branch, "refs/") {
+				// Jenkins prefixes the remote, e.g. origin/main
+				branch = branch[i+1:]
+			}
+			return CIInfo{
+				PipelineID: firstNonEmpty(env("BUILD_TAG"), env("BUILD_NUMBER")),
+				JobURL:     env("BUILD_URL"),
+				Ref:        normaliseRef(env("TAG_NAME"), firstNonEmpty(env("BRANCH_NAME"), branch)),
+				Commit:     env("GIT_COMMIT"),
+				Runner:     env("NODE_NAME"),
+				Repository: env("GIT_URL"),
+			}
+		},
+	},
+	{
+		name:   "buildkite",
+		detect: func(env func(string) string) bool { return env("BUILDKITE") == "true" },
+		info: func(env func(string) string) CIInfo {
+			jobURL := env("BUILDKITE_BUILD_URL")
+			if jobURL != "" && env("BUILDKITE_JOB_ID") != "" {
+				jobURL += "#" + env("BUILDKITE_JOB_ID")
+			}
+			return CIInfo{
+				PipelineID: env("BUILDKITE_BUILD_ID"),
+				JobURL:     jobURL,
+				Ref:        normaliseRef(env("BUILDKITE_TAG"), env("BUILDKITE_BRANCH")),
+				Commit:     env("BUILDKITE_COMMIT"),
+				Runner:     env("BUILDKITE_AGENT_NAME"),
+				Repository: env("BUILDKITE_REPO"),
+			}
+		},
+	},
+	{
+		name:   "drone",
+		detect: func(env func(string) string) bool { return env("DRONE") == "true" },
+		info: func(env func(string) string) CIInfo {
+			return CIInfo{
+				PipelineID: env("DRONE_BUILD_NUMBER"),
+				JobURL:     env("DRONE_BUILD_LINK"),
+				Ref:        firstNonEmpty(env("DRONE_COMMIT_REF"), normaliseRef(env("DRONE_TAG"), env("DRONE_BRANCH"))),
+				Commit:     env("DRONE_COMMIT_SHA"),
+				Runner:     firstNonEmpty(env("DRONE_RUNNER_HOSTNAME"), env("DRONE_RUNNER_NAME")),
+				Repository: env("DRONE_REPO_LINK"),
+			}
+		},
+	},
+}
+
+// DetectCI returns the build information of the CI system hashref runs in
+// or nil outside of CI
+func DetectCI() *CIInfo {
+	for _, system := range ciSystems {
+		if system.detect(os.Getenv) {
+			info := system.info(os.Getenv)
+			info.System = system.name
+			// Checkout urls, e.g. GIT_URL of Jenkins, may contain tokens
+			info.Repository = gitinfo.StripCredentials(info.Repository)
+			return &info
+		}
+	}
+	return nil
+}
+
+// Metadata returns the non-empty build information as metadata with ci_
+// prefixed keys
+func (ci CIInfo) Metadata() map[string]interface{} {
+	meta := map[string]interface{}{}
+	for k, v := range map[string]string{
+		"ci_system":      ci.System,
+		"ci_pipeline_id": ci.PipelineID,
+		"ci_job_url":     ci.JobURL,
+		"ci_ref":         ci.Ref,
+		"ci_commit":      ci.Commit,
+		"ci_runner":      ci.Runner,
+		"ci_repository":  ci.Repository,
+	} {
+		if v != "" {
+			meta[k] = v
+		}
+	}
+	return meta
+}
+
+// normaliseRef returns the full ref of a tag or branch name
+func normaliseRef(tag, branch string) string {
+	switch {
+	case tag != "":
+		return "refs/tags/" + tag
+	case branch == "" || strings.HasPrefix(branch, "refs/"):
+		return branch
+	default:
+		return "refs/heads/" + branch
+	}
+}
+
+// joinURL joins a base url and a path
+func joinURL(base, path string) string {
+	if base == "" || path == "" {
+		return ""
+	}
+	return strings.TrimSuffix(base, "/") + "/" + strings.TrimPrefix(path, "/")
+}
+
+// firstNonEmpty returns the first non-empty value
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
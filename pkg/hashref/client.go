@@ -2,25 +2,63 @@ package hashref
 
 import (
 	"bytes"
+	"crypto/ed25519"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
-	"os"
-	"time"
 
+	"github.com/NodyHub/hashref/pkg/hmacauth"
 	"github.com/NodyHub/hashref/pkg/util"
 )
 
 type HashrefClient struct {
-	config Config
+	config     Config
+	privateKey ed25519.PrivateKey
+	keyring    Keyring
+	creds      *Credentials
+	passphrase func() ([]byte, error)
 }
 
 func NewClient(config Config) HashrefClient {
 	return HashrefClient{config: config}
 }
 
+// newRequest prepares a request to the server with the token as Bearer
+// or the publisher as Authorization. A JSON body is sent with its
+// content type and, if a secret is configured, the request is signed
+// with HMAC-SHA256 for the publisher as key id. Token and secret may come
+// from a credential helper.
+func (hc *HashrefClient) newRequest(method, requestUri string, body []byte) (*http.Request, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequest(method, requestUri, reader)
+	if err != nil {
+		return nil, err
+	}
+	creds, err := hc.credentials()
+	if err != nil {
+		return nil, err
+	}
+	if creds.Token != "" {
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", creds.Token))
+	} else {
+		req.Header.Set("Authorization", fmt.Sprintf("%v", hc.config.Publisher))
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if creds.Secret != "" {
+		if err := hmacauth.Sign(req, hc.config.Publisher, []byte(creds.Secret), body); err != nil {
+			return nil, err
+		}
+	}
+	return req, nil
+}
+
 func (hc *HashrefClient) GetRemoteData(inputType HashType, input, hashValue string) (bool, map[string]interface{}) {
 	log.Printf("Request data for %v %v\n", Lookup[inputType], hashValue)
 	remoteData := make(map[string]interface{})
@@ -28,14 +66,13 @@ func (hc *HashrefClient) GetRemoteData(inputType HashType, input, hashValue stri
 	// prepare get request
 	requestUri := fmt.Sprintf("%v/api/hash/%v", hc.config.HashrefServer, hashValue)
 	log.Printf("Request-uri: %v\n", requestUri)
-	req, err := http.NewRequest(http.MethodGet, requestUri, nil)
+	req, err := hc.newRequest(http.MethodGet, requestUri, nil)
 	if err != nil {
 		log.Printf("ERROR: %v\n", err)
 		return false, map[string]interface{}{
 			"error": err.Error(),
 		}
 	}
-	req.Header.Add("Authorization", fmt.Sprintf("%v", hc.config.Publisher))
 
 	// Create Client
 	client := &http.Client{}
@@ -52,12 +89,19 @@ func (hc *HashrefClient) GetRemoteData(inputType HashType, input, hashValue stri
 	if resp.StatusCode >= 400 {
 		log.Printf("Response Status %v: %v\n", resp.StatusCode, resp.Status)
 		remoteData["status"] = resp.Status
+		remoteData["code"] = resp.StatusCode
 		return false, remoteData
 	}
 	if err := json.Unmarshal(body, &remoteData); err != nil {
-		remoteData["status"] = err.Error()
+		remoteData["error"] = err.Error()
 		return false, remoteData
 	}
+	if !hc.verifySignatures(remoteData, hashValue, "") {
+		return false, unsignedResponse()
+	}
+	if !hc.applyTrust(remoteData, "") {
+		return false, untrustedResponse()
+	}
 	return true, remoteData
 }
 
@@ -67,14 +111,13 @@ func (hc *HashrefClient) GetRemoteDataFromPublisher(inputType HashType, input, h
 	// prepare get request
 	requestUri := fmt.Sprintf("%v/api/hash/%v/publisher/%v", hc.config.HashrefServer, hashValue, publisher)
 	log.Printf("Request-uri: %v\n", requestUri)
-	req, err := http.NewRequest(http.MethodGet, requestUri, nil)
+	req, err := hc.newRequest(http.MethodGet, requestUri, nil)
 	if err != nil {
 		log.Printf("ERROR: %v\n", err)
 		return false, map[string]interface{}{
 			"error": err.Error(),
 		}
 	}
-	req.Header.Add("Authorization", fmt.Sprintf("%v", hc.config.Publisher))
 
 	// Create Client
 	client := &http.Client{}
@@ -102,47 +145,79 @@ func (hc *HashrefClient) GetRemoteDataFromPublisher(inputType HashType, input, h
 			"error": err.Error(),
 		}
 	}
+	if !hc.verifySignatures(remoteData, hashValue, publisher) {
+		return false, unsignedResponse()
+	}
+	if !hc.applyTrust(remoteData, publisher) {
+		return false, untrustedResponse()
+	}
 	return true, remoteData
 }
 
-// RemoveHash deletes the metadata remotly to the provided hash.
-func (hc *HashrefClient) RemoveHash(force bool, input, calculatedHash string) bool {
+// RemoveHash deletes the metadata remotly to the provided hash. If the
+// removal is not confirmed, no request is performed and the returned
+// map is empty.
+func (hc *HashrefClient) RemoveHash(force bool, input, calculatedHash string) (bool, map[string]interface{}) {
 	if !force && !util.YesOrNoQuestion(fmt.Sprintf("Should %v really be removed from hashrev?", input)) {
-		return false
+		return false, map[string]interface{}{}
 	}
 	log.Printf("Delete metadata for %v\n", calculatedHash)
 
 	// prepare delete request
 	requestUri := fmt.Sprintf("%v/api/hash/%v", hc.config.HashrefServer, calculatedHash)
-	req, err := http.NewRequest(http.MethodDelete, requestUri, nil)
+	req, err := hc.newRequest(http.MethodDelete, requestUri, nil)
 	if err != nil {
 		log.Printf("ERROR: %v\n", err)
-		return false
+		return false, map[string]interface{}{
+			"error": err.Error(),
+		}
 	}
 
 	// Create Client
 	client := &http.Client{}
 
-	// Set request meta data
-	req.Header.Set("Authorization", fmt.Sprintf("%v", hc.config.Publisher))
-
 	// Perform request
 	resp, err := client.Do(req)
-	_, err = io.ReadAll(resp.Body)
 	if err != nil {
-		return false
+		log.Printf("ERROR: %v\n", err)
+		return false, map[string]interface{}{
+			"error": err.Error(),
+		}
 	}
 	defer resp.Body.Close()
+	_, err = io.ReadAll(resp.Body)
+	if err != nil {
+		return false, map[string]interface{}{
+			"error": err.Error(),
+		}
+	}
 	if resp.StatusCode >= 400 {
 		log.Printf("Response Status %v: %v\n", resp.StatusCode, resp.Status)
-		return false
+		return false, map[string]interface{}{
+			"status": resp.Status,
+			"code":   resp.StatusCode,
+		}
 	}
-	return true
+	return true, map[string]interface{}{}
 }
 
-func (hc *HashrefClient) SetRemoteData(inputType HashType, input string, calculatedHash string, metadata map[string]interface{}) bool {
+// SetRemoteData publishes the metadata to the provided hash
+func (hc *HashrefClient) SetRemoteData(inputType HashType, input string, calculatedHash string, metadata map[string]interface{}) (bool, map[string]interface{}) {
 	log.Printf("Set data for hash %v\n", calculatedHash)
+	metadata, err := hc.sign(calculatedHash, metadata)
+	if err != nil {
+		log.Printf("ERROR: %v\n", err)
+		return false, map[string]interface{}{
+			"error": err.Error(),
+		}
+	}
 	jsonData, err := json.Marshal(metadata)
+	if err != nil {
+		log.Printf("ERROR: %v\n", err)
+		return false, map[string]interface{}{
+			"error": err.Error(),
+		}
+	}
 
 	// prepare get request
 	targetApi := "hash"
@@ -150,18 +225,12 @@ func (hc *HashrefClient) SetRemoteData(inputType HashType, input string, calcula
 		targetApi = "publisher"
 	}
 	requestUri := fmt.Sprintf("%v/api/%v/%v", hc.config.HashrefServer, targetApi, calculatedHash)
-	req, err := http.NewRequest(http.MethodPost, requestUri, bytes.NewBuffer(jsonData))
+	req, err := hc.newRequest(http.MethodPost, requestUri, jsonData)
 	if err != nil {
 		log.Printf("ERROR: %v\n", err)
-		return false
-	}
-
-	// Set request meta data
-	req.Header.Set("Authorization", fmt.Sprintf("%v", hc.config.Publisher))
-	req.Header.Set("Content-Type", "application/json")
-	if err != nil {
-		log.Printf("ERROR: %v\n", err)
-		return false
+		return false, map[string]interface{}{
+			"error": err.Error(),
+		}
 	}
 
 	// Create Client
@@ -171,7 +240,9 @@ func (hc *HashrefClient) SetRemoteData(inputType HashType, input string, calcula
 	resp, err := client.Do(req)
 	if err != nil {
 		log.Printf("ERROR: %v\n", err)
-		return false
+		return false, map[string]interface{}{
+			"error": err.Error(),
+		}
 	}
 
 	// Get response
@@ -179,24 +250,38 @@ func (hc *HashrefClient) SetRemoteData(inputType HashType, input string, calcula
 	_, err = io.ReadAll(resp.Body)
 	if err != nil {
 		log.Printf("ERROR: %v\n", err)
-		return false
+		return false, map[string]interface{}{
+			"error": err.Error(),
+		}
 	}
 	if resp.StatusCode >= 400 {
 		log.Printf("Response Status %v: %v\n", resp.StatusCode, resp.Status)
-		return false
+		return false, map[string]interface{}{
+			"status": resp.Status,
+			"code":   resp.StatusCode,
+		}
 	}
-	return true
+	return true, metadata
 }
 
 // SetSelf sets the metadata to the hash of the identity remoely
-func (hc *HashrefClient) SetSelf(metadata map[string]interface{}) bool {
+func (hc *HashrefClient) SetSelf(metadata map[string]interface{}) (bool, map[string]interface{}) {
 	log.Printf("Set data for yourself %v\n", hc.config.Publisher)
 
-	// Transform json data
+	// Sign and transform json data
+	metadata, err := hc.sign(CalculateHash([]byte(hc.config.Publisher)), metadata)
+	if err != nil {
+		log.Printf("ERROR: %v\n", err)
+		return false, map[string]interface{}{
+			"error": err.Error(),
+		}
+	}
 	jsonData, err := json.Marshal(metadata)
 	if err != nil {
 		log.Printf("ERROR: %v\n", err)
-		return false
+		return false, map[string]interface{}{
+			"error": err.Error(),
+		}
 	}
 
 	log.Printf("%s\n", jsonData)
@@ -206,19 +291,21 @@ func (hc *HashrefClient) SetSelf(metadata map[string]interface{}) bool {
 
 	// Prepare request obj
 	requestUri := fmt.Sprintf("%v/api/self", hc.config.HashrefServer)
-	req, err := http.NewRequest(http.MethodPost, requestUri, bytes.NewBuffer(jsonData))
+	req, err := hc.newRequest(http.MethodPost, requestUri, jsonData)
 	if err != nil {
 		log.Printf("ERROR: %v\n", err)
-		return false
+		return false, map[string]interface{}{
+			"error": err.Error(),
+		}
 	}
-	req.Header.Set("Authorization", fmt.Sprintf("%v", hc.config.Publisher))
-	req.Header.Set("Content-Type", "application/json")
 
 	// Perform request
 	resp, err := client.Do(req)
 	if err != nil {
 		log.Printf("ERROR: %v\n", err)
-		return false
+		return false, map[string]interface{}{
+			"error": err.Error(),
+		}
 	}
 
 	// Post process response
@@ -226,25 +313,34 @@ func (hc *HashrefClient) SetSelf(metadata map[string]interface{}) bool {
 	_, err = io.ReadAll(resp.Body)
 	if err != nil {
 		log.Printf("ERROR: %v\n", err)
-		return false
+		return false, map[string]interface{}{
+			"error": err.Error(),
+		}
 	}
 	log.Printf("Response Status %v: %v\n", resp.StatusCode, resp.Status)
-	return resp.StatusCode < 400
+	if resp.StatusCode >= 400 {
+		return false, map[string]interface{}{
+			"status": resp.Status,
+			"code":   resp.StatusCode,
+		}
+	}
+	return true, metadata
 }
 
 // GetSelf performs a request to the server and collects the metadata
 // that is stored remotly to the publisher
-func (hc *HashrefClient) GetSelf() map[string]interface{} {
+func (hc *HashrefClient) GetSelf() (bool, map[string]interface{}) {
 
 	// prepare get request
 	requestUri := fmt.Sprintf("%v/api/self", hc.config.HashrefServer)
 	log.Printf("Request-uri: %v\n", requestUri)
-	req, err := http.NewRequest(http.MethodGet, requestUri, nil)
+	req, err := hc.newRequest(http.MethodGet, requestUri, nil)
 	if err != nil {
 		log.Printf("ERROR: %v\n", err)
-		return map[string]interface{}{}
+		return false, map[string]interface{}{
+			"error": err.Error(),
+		}
 	}
-	req.Header.Add("Authorization", fmt.Sprintf("%v", hc.config.Publisher))
 
 	// Create Client
 	client := &http.Client{}
@@ -252,13 +348,15 @@ func (hc *HashrefClient) GetSelf() map[string]interface{} {
 	// Request own data
 	resp, err := client.Do(req)
 	if err != nil {
-		return map[string]interface{}{"Error": err.Error()}
+		return false, map[string]interface{}{
+			"error": err.Error(),
+		}
 	}
 	body, err := io.ReadAll(resp.Body)
 	defer resp.Body.Close()
 	if resp.StatusCode >= 400 {
 		log.Printf("Response Status %v: %v\n", resp.StatusCode, resp.Status)
-		return map[string]interface{}{
+		return false, map[string]interface{}{
 			"status": resp.Status,
 			"code":   resp.StatusCode,
 		}
@@ -267,41 +365,35 @@ func (hc *HashrefClient) GetSelf() map[string]interface{} {
 	// Transform remote data into map
 	remoteData := make(map[string]interface{})
 	if err := json.Unmarshal(body, &remoteData); err != nil {
-		return map[string]interface{}{
-			"Error": err.Error(),
+		return false, map[string]interface{}{
+			"error": err.Error(),
 		}
 	}
-	return remoteData
+	return true, remoteData
 }
 
-// CollectLocalMetadata collects based on the provided input
-// metadata and returns it as a map with metadata
+// CollectLocalMetadata runs the enabled collectors that apply to the
+// input and returns the merged metadata
 func (hc *HashrefClient) CollectLocalMetadata(inputType HashType, input, hash string) map[string]interface{} {
+	return hc.collectMetadata(inputType, input, hash, func(Collector) bool { return true })
+}
 
-	// Default values
-	retMap := map[string]interface{}{
-		"input":          input,
-		"type":           Lookup[inputType],
-		"last_published": time.Now().String(),
-	}
-
-	// Collect further data depended on type
+// collectMetadata runs the enabled collectors that apply to the input and
+// pass the filter
+func (hc *HashrefClient) collectMetadata(inputType HashType, input, hash string, filter func(Collector) bool) map[string]interface{} {
+	retMap := map[string]interface{}{}
 	log.Printf("Collect metadata for %v (%v)\n", input, Lookup[inputType])
-	switch inputType {
-
-	// Get meta to text
-	case Text:
-		retMap["length"] = fmt.Sprint(len(input))
-
-	// Get meta to file
-	case File:
-		fInfo, err := os.Stat(input)
+	for _, c := range hc.collectors() {
+		if !hc.config.CollectorEnabled(c.Name()) || !filter(c) || !c.AppliesTo(inputType, input) {
+			continue
+		}
+		meta, err := c.Collect(inputType, input, hash)
 		if err != nil {
-			log.Printf("ERROR:\n%v", err)
-			return make(map[string]interface{})
+			log.Printf("ERROR: collector %v: %v\n", c.Name(), err)
+		}
+		for k, v := range meta {
+			retMap[k] = v
 		}
-		retMap["permission"] = fInfo.Mode().Perm().String()
-		retMap["size"] = fmt.Sprintf("%v", fInfo.Size())
 	}
 	return retMap
 }
@@ -0,0 +1,349 @@
+package hashref
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/NodyHub/hashref/pkg/bininfo"
+	"github.com/NodyHub/hashref/pkg/gitinfo"
+	"github.com/NodyHub/hashref/pkg/magic"
+)
+
+// CollectorTimeout limits the runtime of external collectors
+var CollectorTimeout = 30 * time.Second
+
+// Collector gathers local metadata of inputs
+type Collector interface {
+	// Name identifies the collector in HASHREF_COLLECTORS and --collectors
+	Name() string
+	// AppliesTo reports if the collector handles the input
+	AppliesTo(inputType HashType, input string) bool
+	// Collect returns the metadata of the input, metadata returned
+	// together with an error is merged as well
+	Collect(inputType HashType, input, hash string) (map[string]interface{}, error)
+}
+
+// KeyCollector is a Collector that declares the metadata keys it
+// provides, keys ending with * match all keys with the prefix. Collectors
+// that do not declare their keys may provide any key.
+type KeyCollector interface {
+	Collector
+	Keys() []string
+}
+
+// funcCollector implements Collector with functions
+type funcCollector struct {
+	name      string
+	keys      []string
+	appliesTo func(inputType HashType, input string) bool
+	collect   func(inputType HashType, input, hash string) (map[string]interface{}, error)
+}
+
+func (f funcCollector) Name() string {
+	return f.name
+}
+
+func (f funcCollector) Keys() []string {
+	return f.keys
+}
+
+func (f funcCollector) AppliesTo(inputType HashType, input string) bool {
+	return f.appliesTo == nil || f.appliesTo(inputType, input)
+}
+
+func (f funcCollector) Collect(inputType HashType, input, hash string) (map[string]interface{}, error) {
+	return f.collect(inputType, input, hash)
+}
+
+// NewCollector returns a collector from functions, without appliesTo the
+// collector applies to all inputs
+func NewCollector(name string, appliesTo func(HashType, string) bool, collect func(HashType, string, string) (map[string]interface{}, error)) Collector {
+	return funcCollector{name: name, appliesTo: appliesTo, collect: collect}
+}
+
+// withKeys declares the keys of a collector created by NewCollector
+func withKeys(c Collector, keys ...string) Collector {
+	f := c.(funcCollector)
+	f.keys = keys
+	return f
+}
+
+// onlyType returns a predicate matching inputs of the type
+func onlyType(t HashType) func(HashType, string) bool {
+	return func(inputType HashType, input string) bool {
+		return inputType == t
+	}
+}
+
+// Built-in collectors
+var (
+	baseCollector = NewCollector("base", nil, func(inputType HashType, input, hash string) (map[string]interface{}, error) {
+		return map[string]interface{}{
+			"input":          input,
+			"type":           Lookup[inputType],
+			"last_published": time.Now().String(),
+		}, nil
+	})
+	textCollector = NewCollector("text", onlyType(Text), func(inputType HashType, input, hash string) (map[string]interface{}, error) {
+		return map[string]interface{}{"length": fmt.Sprint(len(input))}, nil
+	})
+	fileCollector = NewCollector("file", onlyType(File), func(inputType HashType, input, hash string) (map[string]interface{}, error) {
+		fInfo, err := os.Stat(input)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{
+			"permission": fInfo.Mode().Perm().String(),
+			"size":       fmt.Sprintf("%v", fInfo.Size()),
+		}, nil
+	})
+	contentCollector = NewCollector("content", onlyType(File), func(inputType HashType, input, hash string) (map[string]interface{}, error) {
+		info, err := magic.Detect(input)
+		if err != nil {
+			return nil, err
+		}
+		return info.Metadata(), nil
+	})
+	gitCollector    = NewCollector("git", onlyType(File), collectGitProvenance)
+	binaryCollector = NewCollector("binary", onlyType(File), func(inputType HashType, input, hash string) (map[string]interface{}, error) {
+		info, err := bininfo.Analyze(input)
+		if errors.Is(err, bininfo.ErrNotBinary) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return info.Metadata(), nil
+	})
+	ciCollector = NewCollector("ci", nil, func(inputType HashType, input, hash string) (map[string]interface{}, error) {
+		if ci := DetectCI(); ci != nil {
+			return ci.Metadata(), nil
+		}
+		return nil, nil
+	})
+)
+
+// collectors are the registered collectors in order of execution
+var collectors = []Collector{
+	withKeys(baseCollector, "input", "type", "last_published"),
+	withKeys(textCollector, "length"),
+	withKeys(fileCollector, "permission", "size"),
+	withKeys(contentCollector, "content_*"),
+	withKeys(gitCollector, "git_*"),
+	withKeys(binaryCollector, "binary_*", "go_*"),
+	withKeys(ciCollector, "ci_*"),
+}
+
+// collectorKeys returns the declared keys of the collector, ok is false
+// for collectors that may provide any key
+func collectorKeys(c Collector) (keys []string, ok bool) {
+	if kc, isKeyed := c.(KeyCollector); isKeyed && kc.Keys() != nil {
+		return kc.Keys(), true
+	}
+	return nil, false
+}
+
+// matchesKey reports if a declared key, possibly a prefix with *,
+// matches the metadata key
+func matchesKey(declared, key string) bool {
+	if strings.HasSuffix(declared, "*") {
+		return strings.HasPrefix(key, strings.TrimSuffix(declared, "*"))
+	}
+	return declared == key
+}
+
+// providers returns a filter for the collectors that provide one of the
+// keys. Collectors without declared keys are only needed for keys that
+// no collector declares.
+func providers(all []Collector, keys []string) func(Collector) bool {
+	undeclared := false
+	for _, key := range keys {
+		declared := false
+		for _, c := range all {
+			cKeys, _ := collectorKeys(c)
+			for _, d := range cKeys {
+				declared = declared || matchesKey(d, key)
+			}
+		}
+		undeclared = undeclared || !declared
+	}
+	return func(c Collector) bool {
+		cKeys, ok := collectorKeys(c)
+		if !ok {
+			return undeclared
+		}
+		for _, d := range cKeys {
+			for _, key := range keys {
+				if matchesKey(d, key) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+}
+
+// RegisterCollector adds a collector, names must be unique
+func RegisterCollector(c Collector) error {
+	if isCollector(c.Name()) {
+		return fmt.Errorf("collector %v is already registered", c.Name())
+	}
+	collectors = append(collectors, c)
+	return nil
+}
+
+// CollectorNames returns the names of the registered collectors
+func CollectorNames() []string {
+	names := make([]string, 0, len(collectors))
+	for _, c := range collectors {
+		names = append(names, c.Name())
+	}
+	return names
+}
+
+// isCollector reports if a collector with the name is registered
+func isCollector(name string) bool {
+	for _, c := range collectors {
+		if c.Name() == name {
+			return true
+		}
+	}
+	return false
+}
+
+// collectors returns the registered collectors followed by the external
+// collectors of the config sorted by name
+func (hc *HashrefClient) collectors() []Collector {
+	all := append([]Collector{}, collectors...)
+	names := make([]string, 0, len(hc.config.CollectorCommands))
+	for name := range hc.config.CollectorCommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		all = append(all, &ProcessCollector{CollectorName: name, Command: strings.Fields(hc.config.CollectorCommands[name])})
+	}
+	return all
+}
+
+// CollectorEnabled reports if the collector is enabled by the entries of
+// HASHREF_COLLECTORS, evaluated in order: name enables and -name disables
+// a collector, all and -all every collector. Collectors are enabled by
+// default, git only if HASHREF_GIT_PROVENANCE is true.
+func (c Config) CollectorEnabled(name string) bool {
+	enabled := name != gitCollector.Name() || c.GitProvenance
+	for _, entry := range c.Collectors {
+		switch strings.TrimSpace(entry) {
+		case name, "+" + name, "all", "+all":
+			enabled = true
+		case "-" + name, "-all":
+			enabled = false
+		}
+	}
+	return enabled
+}
+
+// validateCollectors checks the collector entries and external commands
+func (c Config) validateCollectors() []string {
+	var errs []string
+	for _, entry := range c.Collectors {
+		name := strings.TrimLeft(strings.TrimSpace(entry), "+-")
+		if _, external := c.CollectorCommands[name]; name != "all" && !isCollector(name) && !external {
+			errs = append(errs, fmt.Sprintf("HASHREF_COLLECTORS: unknown collector %q, available: %v", name, c.collectorNames()))
+		}
+	}
+	for name, command := range c.CollectorCommands {
+		if isCollector(name) || name == "all" {
+			errs = append(errs, fmt.Sprintf("HASHREF_COLLECTOR_COMMANDS: %v is a built-in collector", name))
+		}
+		if len(strings.Fields(command)) == 0 {
+			errs = append(errs, fmt.Sprintf("HASHREF_COLLECTOR_COMMANDS: %v has no command", name))
+		}
+	}
+	sort.Strings(errs)
+	return errs
+}
+
+// collectorNames returns the registered and external collector names
+func (c Config) collectorNames() []string {
+	names := CollectorNames()
+	for name := range c.CollectorCommands {
+		names = append(names, name)
+	}
+	return names
+}
+
+// collectGitProvenance returns the git provenance of a file, files outside
+// of a git checkout have no provenance
+func collectGitProvenance(inputType HashType, input, hash string) (map[string]interface{}, error) {
+	p, err := gitinfo.FileProvenance(input)
+	if errors.Is(err, gitinfo.ErrNotRepository) {
+		return nil, nil
+	}
+	if p == nil {
+		return nil, err
+	}
+	if err != nil {
+		err = fmt.Errorf("git provenance of %v is incomplete: %v", input, err)
+	}
+	meta := map[string]interface{}{}
+	for k, v := range map[string]string{
+		"git_remote":      p.Remote,
+		"git_commit":      p.Commit,
+		"git_branch":      p.Branch,
+		"git_path":        p.Path,
+		"git_dirty":       fmt.Sprint(p.Dirty),
+		"git_last_commit": p.LastCommit,
+	} {
+		if v != "" {
+			meta[k] = v
+		}
+	}
+	return meta, err
+}
+
+// ProcessCollector runs an external command with the file path as last
+// argument and merges the JSON object of its stdout
+type ProcessCollector struct {
+	CollectorName string
+	Command       []string
+}
+
+func (p *ProcessCollector) Name() string {
+	return p.CollectorName
+}
+
+func (p *ProcessCollector) AppliesTo(inputType HashType, input string) bool {
+	return inputType == File
+}
+
+func (p *ProcessCollector) Collect(inputType HashType, input, hash string) (map[string]interface{}, error) {
+	if len(p.Command) == 0 {
+		return nil, fmt.Errorf("no command")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), CollectorTimeout)
+	defer cancel()
+	log.Printf("Run collector %v for %v\n", p.CollectorName, input)
+	args := append(append([]string{}, p.Command[1:]...), input)
+	cmd := exec.CommandContext(ctx, p.Command[0], args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%v failed: %v %v", p.Command[0], err, strings.TrimSpace(stderr.String()))
+	}
+	meta := map[string]interface{}{}
+	if err := json.Unmarshal(out, &meta); err != nil {
+		return nil, fmt.Errorf("%v returned no JSON object: %v", p.Command[0], err)
+	}
+	return meta, nil
+}
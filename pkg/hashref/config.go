@@ -2,56 +2,133 @@ package hashref
 
 import (
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
-	"path/filepath"
-
-	"github.com/NodyHub/hashref/pkg/util"
+	"strings"
 )
 
+// Config of the client. The json names are used in config files and as
+// environment variables.
 type Config struct {
-	Publisher     string            `json:"HASHREF_PUBLISHER"`
-	DefaultMeta   map[string]string `json:"HASHREF_DEFAULT_META"`
-	HashrefServer string            `json:"HASHREF_SERVER"`
-}
+	Publisher         string             `json:"HASHREF_PUBLISHER"`
+	DefaultMeta       map[string]string  `json:"HASHREF_DEFAULT_META"`
+	HashrefServer     string             `json:"HASHREF_SERVER"`
+	TrustedPublishers []TrustedPublisher `json:"HASHREF_TRUSTED_PUBLISHERS"`
+	Untrusted         string             `json:"HASHREF_UNTRUSTED"`
+	SigningKey        string             `json:"HASHREF_SIGNING_KEY"`
+	Keyring           string             `json:"HASHREF_KEYRING"`
+	RequireSigned     bool               `json:"HASHREF_REQUIRE_SIGNED"`
+	Secret            string             `json:"HASHREF_SECRET"`
+	Token             string             `json:"HASHREF_TOKEN"`
+	CredentialHelper  string             `json:"HASHREF_CREDENTIAL_HELPER"`
+	CredentialStore   string             `json:"HASHREF_CREDENTIAL_STORE"`
+	GitProvenance     bool               `json:"HASHREF_GIT_PROVENANCE"`
+	Collectors        []string           `json:"HASHREF_COLLECTORS"`
+	CollectorCommands map[string]string  `json:"HASHREF_COLLECTOR_COMMANDS"`
+	Profile           string             `json:"HASHREF_PROFILE,omitempty"`
+	Profiles          map[string]Profile `json:"HASHREF_PROFILES,omitempty"`
 
-// LoadConfig loads the configuration from the provided file path
-func LoadConfig(cfgFileName string) Config {
-	log.Println("Try to load hashref configuration json")
+	origins map[string]string
+}
 
-	// figure out home dir and use that as cfg path
-	if len(cfgFileName) == 0 {
-		dirname, err := os.UserHomeDir()
-		if err != nil {
-			log.Println("Could not figure out USER_HOME")
-			return getDefaultConfig()
-		}
-		cfgFileName = filepath.Join(dirname, ".hashref")
-	}
+// LoadConfig loads the configuration layers in order, later layers
+// overwrite the fields of earlier ones, see ConfigLayers. Unreadable
+// files, invalid JSON and unknown keys are reported as error.
+func LoadConfig(cfgFileName string) (Config, error) {
+	log.Println("Try to load hashref configuration")
 
 	// create empty default cfg
 	cfg := NewConfig()
 
-	// load file
+	// an explicit config has to exist
+	var errs []string
 	if cfgFileName != "" {
-		cfgFile, err := ioutil.ReadFile(cfgFileName)
-		if err != nil {
-			log.Printf("ERROR: %v\n", err) // Cannot read config: %v\n", CLI.Config)
-			log.Println("Loading default config")
-		} else {
-			err := json.Unmarshal([]byte(cfgFile), &cfg)
-			if err != nil {
-				log.Printf("%v\n", err)
-				log.Println("Loading default config")
-			} else {
-				log.Printf("Loading config %v successfull!\n", cfgFileName)
-			}
+		if _, err := os.Stat(cfgFileName); err != nil {
+			errs = append(errs, fmt.Sprintf("config %v does not exist", cfgFileName))
+		}
+	}
+
+	// load files, the project config is restricted
+	project := ""
+	if cfgFileName == "" {
+		project = projectConfigPath()
+	}
+	for _, layer := range ConfigLayers(cfgFileName) {
+		if err := cfg.loadLayer(layer, layer == project); err != nil {
+			log.Printf("ERROR: %v\n", err)
+			errs = append(errs, fmt.Sprintf("config %v: %v", layer, err))
+			continue
 		}
+		log.Printf("Loading config %v successfull!\n", layer)
 	}
 
 	// finalize
-	return cfg
+	if len(errs) > 0 {
+		return cfg, fmt.Errorf("%v", strings.Join(errs, "; "))
+	}
+	return cfg, nil
+}
+
+// loadLayer overlays the fields of the config file and records the file
+// as their origin, project configs may only set harmless fields
+func (c *Config) loadLayer(cfgFileName string, project bool) error {
+	raw, err := ioutil.ReadFile(cfgFileName)
+	if err != nil {
+		return err
+	}
+	fields, err := DecodeConfig(DetectFormat(cfgFileName, raw), raw)
+	if err != nil {
+		return err
+	}
+	if err := CheckKeys(fields); err != nil {
+		return err
+	}
+	if project {
+		if err := checkProjectFields(fields); err != nil {
+			return err
+		}
+	}
+	b, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(b, c); err != nil {
+		return err
+	}
+	for key := range fields {
+		c.SetOrigin(key, cfgFileName)
+	}
+	return nil
+}
+
+// LoadConfigFile reads the config file as map to edit it without
+// losing unknown fields, a missing file is an empty config
+func LoadConfigFile(cfgFileName string) (map[string]interface{}, error) {
+	raw, err := os.ReadFile(cfgFileName)
+	if os.IsNotExist(err) {
+		return map[string]interface{}{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	fields, err := DecodeConfig(DetectFormat(cfgFileName, raw), raw)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse config %v: %v", cfgFileName, err)
+	}
+	return fields, nil
+}
+
+// WriteConfigFile writes the fields in the format of the existing file
+// or, for new files, of the extension with JSON as default. Comments of
+// YAML and TOML files are not preserved.
+func WriteConfigFile(cfgFileName string, fields map[string]interface{}) error {
+	b, err := EncodeConfig(fileFormat(cfgFileName), fields)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(cfgFileName, b, 0600)
 }
 
 // NewConfig returns a Config object with default values
@@ -60,36 +137,63 @@ func NewConfig() Config {
 }
 
 // LoadEnvValues loads Config object values based on the json field
-// names from the environment
-func (c *Config) LoadEnvValues() {
+// names from the environment. Entries of maps can also be set per key,
+// e.g. HASHREF_DEFAULT_META_team=sec.
+func (c *Config) LoadEnvValues() error {
 	log.Println("Check env for configuration")
+	var errs []string
 	for _, key := range GetJsonFields() {
 		if value := os.Getenv(key); value != "" {
 			log.Printf("Found '%v' in env\n", key)
-			util.SetValueInStructByJsonKey(c, key, value)
+			if err := c.SetFieldFromString(key, value); err != nil {
+				errs = append(errs, err.Error())
+				continue
+			}
+			c.SetOrigin(key, OriginEnv)
+		}
+	}
+	for _, key := range c.mapFields() {
+		for entry, value := range envEntries(key) {
+			log.Printf("Found '%v_%v' in env\n", key, entry)
+			if err := c.setMapEntry(key, entry, value); err != nil {
+				errs = append(errs, err.Error())
+				continue
+			}
+			c.SetOrigin(key, OriginEnv)
 		}
 	}
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid environment: %v", strings.Join(errs, "; "))
+	}
+	return nil
+}
 
+// Redacted returns a copy of the config with masked credentials
+func (c Config) Redacted() Config {
+	if c.Secret != "" {
+		c.Secret = "***"
+	}
+	if c.Token != "" {
+		c.Token = "***"
+	}
+	return c
 }
 
 // getDefaultConfig returns a Config object with default values
 func getDefaultConfig() Config {
 	return Config{
-		Publisher:     "anonymous",
-		DefaultMeta:   map[string]string{},
-		HashrefServer: "http://127.0.0.1:8080",
+		Publisher:         "anonymous",
+		DefaultMeta:       map[string]string{},
+		HashrefServer:     "http://127.0.0.1:8080",
+		TrustedPublishers: []TrustedPublisher{},
+		Untrusted:         UntrustedShow,
+		Collectors:        []string{},
+		CollectorCommands: map[string]string{},
 	}
 }
 
 // GetJsonFields returns a slice of strings with json field names
 // for a Config object
 func GetJsonFields() (fields []string) {
-	cfg := getDefaultConfig()
-	bCfg, _ := json.Marshal(cfg)
-	keyMap := map[string]string{}
-	json.Unmarshal(bCfg, &keyMap)
-	for key := range keyMap {
-		fields = append(fields, key)
-	}
-	return fields
+	return getDefaultConfig().FieldNames()
 }
@@ -0,0 +1,273 @@
+package hashref
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// CredentialHelperFile selects the built-in encrypted file store
+const CredentialHelperFile = "file"
+
+// PassphraseEnv holds the passphrase of the encrypted file store
+const PassphraseEnv = "HASHREF_CREDENTIAL_PASSPHRASE"
+
+// Credentials are the secrets of a publisher on a server
+type Credentials struct {
+	Token  string `json:"token,omitempty"`
+	Secret string `json:"secret,omitempty"`
+}
+
+// CredentialRequest identifies the credentials of a publisher
+type CredentialRequest struct {
+	Server    string `json:"server"`
+	Publisher string `json:"publisher"`
+}
+
+// CredentialHelper stores and returns credentials outside of the config
+type CredentialHelper interface {
+	Get(req CredentialRequest) (Credentials, error)
+	Store(req CredentialRequest, creds Credentials) error
+	Erase(req CredentialRequest) error
+}
+
+// NewCredentialHelper returns the configured credential helper or nil.
+// The passphrase of the file store is requested on first use.
+func NewCredentialHelper(c Config, passphrase func() ([]byte, error)) CredentialHelper {
+	switch c.CredentialHelper {
+	case "":
+		return nil
+	case CredentialHelperFile:
+		return &FileStore{Path: c.credentialStorePath(), Passphrase: passphrase}
+	default:
+		return &ProcessHelper{Command: strings.Fields(c.CredentialHelper)}
+	}
+}
+
+// credentialStorePath returns the configured store or ~/.hashref.credentials
+func (c Config) credentialStorePath() string {
+	if c.CredentialStore != "" {
+		return c.CredentialStore
+	}
+	dirname, err := os.UserHomeDir()
+	if err != nil {
+		return ".hashref.credentials"
+	}
+	return filepath.Join(dirname, ".hashref.credentials")
+}
+
+// ProcessHelper runs an external command with the operation (get, store
+// or erase) as last argument. The request, for store with the
+// credentials, is written as JSON to stdin. For get the credentials are
+// read as JSON from stdout.
+type ProcessHelper struct {
+	Command []string
+}
+
+func (p *ProcessHelper) Get(req CredentialRequest) (Credentials, error) {
+	creds := Credentials{}
+	out, err := p.run("get", req)
+	if err != nil {
+		return creds, err
+	}
+	if err := json.Unmarshal(out, &creds); err != nil {
+		return creds, fmt.Errorf("credential helper returned invalid JSON: %v", err)
+	}
+	return creds, nil
+}
+
+func (p *ProcessHelper) Store(req CredentialRequest, creds Credentials) error {
+	_, err := p.run("store", struct {
+		CredentialRequest
+		Credentials
+	}{req, creds})
+	return err
+}
+
+func (p *ProcessHelper) Erase(req CredentialRequest) error {
+	_, err := p.run("erase", req)
+	return err
+}
+
+// run executes the helper and returns its stdout
+func (p *ProcessHelper) run(operation string, input interface{}) ([]byte, error) {
+	if len(p.Command) == 0 {
+		return nil, fmt.Errorf("no credential helper command")
+	}
+	b, err := json.Marshal(input)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Run credential helper %v %v\n", p.Command[0], operation)
+	args := append(append([]string{}, p.Command[1:]...), operation)
+	cmd := exec.Command(p.Command[0], args...)
+	cmd.Stdin = bytes.NewReader(b)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("credential helper %v %v failed: %v %v", p.Command[0], operation, err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// FileStore keeps credentials in a file encrypted with AES-256-GCM, the
+// key is derived from the passphrase with scrypt
+type FileStore struct {
+	Path       string
+	Passphrase func() ([]byte, error)
+
+	passphrase []byte
+}
+
+// encryptedFile is the format of the file store
+type encryptedFile struct {
+	Version int    `json:"version"`
+	Salt    []byte `json:"salt"`
+	Nonce   []byte `json:"nonce"`
+	Data    []byte `json:"data"`
+}
+
+func (f *FileStore) Get(req CredentialRequest) (Credentials, error) {
+	entries, err := f.load()
+	if err != nil {
+		return Credentials{}, err
+	}
+	return entries[credentialKey(req)], nil
+}
+
+func (f *FileStore) Store(req CredentialRequest, creds Credentials) error {
+	entries, err := f.load()
+	if err != nil {
+		return err
+	}
+	entries[credentialKey(req)] = creds
+	return f.save(entries)
+}
+
+func (f *FileStore) Erase(req CredentialRequest) error {
+	entries, err := f.load()
+	if err != nil {
+		return err
+	}
+	delete(entries, credentialKey(req))
+	return f.save(entries)
+}
+
+// load decrypts the store, a missing file is an empty store
+func (f *FileStore) load() (map[string]Credentials, error) {
+	entries := map[string]Credentials{}
+	raw, err := os.ReadFile(f.Path)
+	if os.IsNotExist(err) {
+		return entries, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	file := encryptedFile{}
+	if err := json.Unmarshal(raw, &file); err != nil {
+		return nil, fmt.Errorf("could not parse credential store %v: %v", f.Path, err)
+	}
+	if file.Version != 1 {
+		return nil, fmt.Errorf("unsupported credential store version %v", file.Version)
+	}
+	aead, err := f.cipher(file.Salt)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := aead.Open(nil, file.Nonce, file.Data, nil)
+	if err != nil {
+		return nil, fmt.Errorf("could not decrypt credential store %v, wrong passphrase?", f.Path)
+	}
+	if err := json.Unmarshal(plain, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// save encrypts the entries with a fresh salt and nonce
+func (f *FileStore) save(entries map[string]Credentials) error {
+	plain, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+	file := encryptedFile{Version: 1, Salt: make([]byte, 16)}
+	if _, err := rand.Read(file.Salt); err != nil {
+		return err
+	}
+	aead, err := f.cipher(file.Salt)
+	if err != nil {
+		return err
+	}
+	file.Nonce = make([]byte, aead.NonceSize())
+	if _, err := rand.Read(file.Nonce); err != nil {
+		return err
+	}
+	file.Data = aead.Seal(nil, file.Nonce, plain, nil)
+	b, err := json.MarshalIndent(file, "", "    ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(f.Path, append(b, '\n'), 0600)
+}
+
+// cipher derives the key for the salt from the passphrase
+func (f *FileStore) cipher(salt []byte) (cipher.AEAD, error) {
+	if f.passphrase == nil {
+		if f.Passphrase == nil {
+			return nil, fmt.Errorf("no passphrase for credential store, set %v", PassphraseEnv)
+		}
+		passphrase, err := f.Passphrase()
+		if err != nil {
+			return nil, err
+		}
+		f.passphrase = passphrase
+	}
+	key, err := scrypt.Key(f.passphrase, salt, 1<<15, 8, 1, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// credentialKey identifies credentials in the file store
+func credentialKey(req CredentialRequest) string {
+	return fmt.Sprintf("%v %v", req.Server, req.Publisher)
+}
+
+// credentials returns the token and secret of the config or, if both
+// are empty, fetches them once from the credential helper
+func (hc *HashrefClient) credentials() (Credentials, error) {
+	if hc.config.Token != "" || hc.config.Secret != "" || hc.config.CredentialHelper == "" {
+		return Credentials{Token: hc.config.Token, Secret: hc.config.Secret}, nil
+	}
+	if hc.creds == nil {
+		helper := NewCredentialHelper(hc.config, hc.passphrase)
+		creds, err := helper.Get(CredentialRequest{Server: hc.config.HashrefServer, Publisher: hc.config.Publisher})
+		if err != nil {
+			return Credentials{}, err
+		}
+		hc.creds = &creds
+	}
+	return *hc.creds, nil
+}
+
+// SetPassphrase sets the function that asks for the passphrase of the
+// encrypted file store
+func (hc *HashrefClient) SetPassphrase(passphrase func() ([]byte, error)) {
+	hc.passphrase = passphrase
+}
@@ -0,0 +1,102 @@
+package hashref
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// SetConfigValue sets the key in config file content, in the named
+// profile if provided. The value is parsed like environment variables,
+// KEY.entry sets a single entry of a map field.
+func SetConfigValue(fields map[string]interface{}, profile, key, value string) error {
+	target, err := editTarget(fields, profile, true)
+	if err != nil {
+		return err
+	}
+	base, entry, isEntry := strings.Cut(key, ".")
+	if !isConfigKey(base) {
+		return fmt.Errorf("unknown key %v", base)
+	}
+
+	// Set a single entry of a map
+	if isEntry {
+		scratch := Config{}
+		if err := scratch.setMapEntry(base, entry, value); err != nil {
+			return err
+		}
+		m, ok := target[base].(map[string]interface{})
+		if !ok {
+			m = map[string]interface{}{}
+		}
+		m[entry] = value
+		target[base] = m
+		return nil
+	}
+
+	scratch := Config{}
+	if err := scratch.SetFieldFromString(base, value); err != nil {
+		return err
+	}
+	target[base] = scratch.Fields()[base]
+	return nil
+}
+
+// UnsetConfigValue removes the key or map entry from config file
+// content, unknown keys can be removed as well
+func UnsetConfigValue(fields map[string]interface{}, profile, key string) error {
+	target, err := editTarget(fields, profile, false)
+	if err != nil {
+		return err
+	}
+	base, entry, isEntry := strings.Cut(key, ".")
+	if _, ok := target[base]; !ok && !isConfigKey(base) {
+		return fmt.Errorf("unknown key %v", base)
+	}
+	if isEntry {
+		if m, ok := target[base].(map[string]interface{}); ok {
+			delete(m, entry)
+		}
+		return nil
+	}
+	delete(target, base)
+	return nil
+}
+
+// ConfigFromFields returns the default config overlaid with config file
+// content
+func ConfigFromFields(fields map[string]interface{}) (Config, error) {
+	cfg := NewConfig()
+	if err := CheckKeys(fields); err != nil {
+		return cfg, err
+	}
+	b, err := json.Marshal(fields)
+	if err != nil {
+		return cfg, err
+	}
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		return cfg, err
+	}
+	return cfg, nil
+}
+
+// editTarget returns the top level fields or the fields of the profile
+func editTarget(fields map[string]interface{}, profile string, create bool) (map[string]interface{}, error) {
+	if profile == "" {
+		return fields, nil
+	}
+	profiles, ok := fields["HASHREF_PROFILES"].(map[string]interface{})
+	if !ok {
+		profiles = map[string]interface{}{}
+	}
+	target, ok := profiles[profile].(map[string]interface{})
+	if !ok {
+		if !create {
+			return nil, fmt.Errorf("unknown profile %q", profile)
+		}
+		target = map[string]interface{}{}
+	}
+	profiles[profile] = target
+	fields["HASHREF_PROFILES"] = profiles
+	return target, nil
+}
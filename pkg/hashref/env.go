@@ -0,0 +1,153 @@
+package hashref
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// SetFieldFromString parses the value according to the type of the
+// config field with the json name and assigns it. Maps accept a JSON
+// object or k=v,k2=v2, lists a JSON array or comma separated values,
+// durations are parsed with time.ParseDuration. Other types are JSON.
+func (c *Config) SetFieldFromString(key, value string) error {
+	field, ok := c.field(key)
+	if !ok {
+		return fmt.Errorf("unknown config field %v", key)
+	}
+	if err := parseInto(field, value); err != nil {
+		return fmt.Errorf("%v: %v", key, err)
+	}
+	return nil
+}
+
+// setMapEntry sets a single key of a map field
+func (c *Config) setMapEntry(key, entry, value string) error {
+	field, ok := c.field(key)
+	if !ok || field.Kind() != reflect.Map || field.Type().Elem().Kind() != reflect.String {
+		return fmt.Errorf("%v is not a map of strings", key)
+	}
+	if field.IsNil() {
+		field.Set(reflect.MakeMap(field.Type()))
+	}
+	field.SetMapIndex(reflect.ValueOf(entry), reflect.ValueOf(value))
+	return nil
+}
+
+// field returns the settable struct field with the json name
+func (c *Config) field(key string) (reflect.Value, bool) {
+	v := reflect.ValueOf(c).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		name := strings.Split(v.Type().Field(i).Tag.Get("json"), ",")[0]
+		if name == key && v.Field(i).CanSet() {
+			return v.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+// mapFields returns the json names of the fields that are maps of strings
+func (c *Config) mapFields() []string {
+	names := []string{}
+	t := reflect.TypeOf(*c)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Type.Kind() == reflect.Map && f.Type.Elem().Kind() == reflect.String {
+			names = append(names, strings.Split(f.Tag.Get("json"), ",")[0])
+		}
+	}
+	return names
+}
+
+// parseInto assigns the parsed value to the field
+func parseInto(field reflect.Value, value string) error {
+	trimmed := strings.TrimSpace(value)
+	switch {
+	case field.Type() == durationType:
+		d, err := time.ParseDuration(trimmed)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", value)
+		}
+		field.SetInt(int64(d))
+	case field.Kind() == reflect.String:
+		field.SetString(value)
+	case field.Kind() == reflect.Bool:
+		b, err := parseBool(trimmed)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case field.Kind() >= reflect.Int && field.Kind() <= reflect.Int64:
+		i, err := strconv.ParseInt(trimmed, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", value)
+		}
+		field.SetInt(i)
+	case field.Kind() == reflect.Map && field.Type().Elem().Kind() == reflect.String && !strings.HasPrefix(trimmed, "{"):
+		m := reflect.MakeMap(field.Type())
+		for _, pair := range splitList(trimmed) {
+			k, v, ok := strings.Cut(pair, "=")
+			if !ok || strings.TrimSpace(k) == "" {
+				return fmt.Errorf("invalid entry %q, expected key=value", pair)
+			}
+			m.SetMapIndex(reflect.ValueOf(strings.TrimSpace(k)), reflect.ValueOf(strings.TrimSpace(v)))
+		}
+		field.Set(m)
+	case field.Kind() == reflect.Slice && field.Type().Elem().Kind() == reflect.String && !strings.HasPrefix(trimmed, "["):
+		list := splitList(trimmed)
+		for i := range list {
+			list[i] = strings.TrimSpace(list[i])
+		}
+		field.Set(reflect.ValueOf(list).Convert(field.Type()))
+	default:
+		ptr := reflect.New(field.Type())
+		if err := json.Unmarshal([]byte(trimmed), ptr.Interface()); err != nil {
+			return fmt.Errorf("invalid JSON for %v: %v", field.Type(), err)
+		}
+		field.Set(ptr.Elem())
+	}
+	return nil
+}
+
+// parseBool accepts the values of strconv.ParseBool and yes/no, on/off
+func parseBool(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "yes", "y", "on":
+		return true, nil
+	case "no", "n", "off":
+		return false, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid boolean %q", value)
+	}
+	return b, nil
+}
+
+// splitList splits comma separated values, an empty string is an empty list
+func splitList(value string) []string {
+	if value == "" {
+		return []string{}
+	}
+	return strings.Split(value, ",")
+}
+
+// envEntries returns the map entries set by per key variables, e.g.
+// HASHREF_DEFAULT_META_team=sec
+func envEntries(key string) map[string]string {
+	entries := map[string]string{}
+	prefix := key + "_"
+	for _, env := range os.Environ() {
+		name, value, _ := strings.Cut(env, "=")
+		if strings.HasPrefix(name, prefix) && len(name) > len(prefix) {
+			entries[strings.TrimPrefix(name, prefix)] = value
+		}
+	}
+	return entries
+}
@@ -0,0 +1,180 @@
+package hashref
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Config file formats
+const (
+	FormatJSON = "json"
+	FormatYAML = "yaml"
+	FormatTOML = "toml"
+)
+
+// ConfigFormats lists the supported config file formats
+var ConfigFormats = []string{FormatJSON, FormatYAML, FormatTOML}
+
+// configExtensions are tried in order for config files without extension
+var configExtensions = []string{"", ".yaml", ".yml", ".toml", ".json"}
+
+var tomlLine = regexp.MustCompile(`^(\[|[A-Za-z0-9_."-]+\s*=)`)
+
+// FormatByExtension returns the format of the file extension or an
+// empty string
+func FormatByExtension(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return FormatJSON
+	case ".yaml", ".yml":
+		return FormatYAML
+	case ".toml":
+		return FormatTOML
+	}
+	return ""
+}
+
+// DetectFormat returns the format of a config file by its extension or,
+// without known extension, by the first line that is no comment
+func DetectFormat(path string, raw []byte) string {
+	if format := FormatByExtension(path); format != "" {
+		return format
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(raw))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "" || strings.HasPrefix(line, "#"):
+			continue
+		case strings.HasPrefix(line, "{"):
+			return FormatJSON
+		case tomlLine.MatchString(line):
+			return FormatTOML
+		default:
+			return FormatYAML
+		}
+	}
+	return FormatJSON
+}
+
+// DecodeConfig parses config file content of the format into a map with
+// JSON compatible values
+func DecodeConfig(format string, raw []byte) (map[string]interface{}, error) {
+	fields := map[string]interface{}{}
+	var err error
+	switch format {
+	case FormatJSON:
+		err = json.Unmarshal(raw, &fields)
+	case FormatYAML:
+		err = yaml.Unmarshal(raw, &fields)
+	case FormatTOML:
+		err = toml.Unmarshal(raw, &fields)
+	default:
+		err = fmt.Errorf("unknown config format %v", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if fields == nil {
+		fields = map[string]interface{}{}
+	}
+
+	// Normalize by a JSON round trip
+	b, err := json.Marshal(fields)
+	if err != nil {
+		return nil, err
+	}
+	normalized := map[string]interface{}{}
+	if err := json.Unmarshal(b, &normalized); err != nil {
+		return nil, err
+	}
+	return normalized, nil
+}
+
+// EncodeConfig returns config file content in the format, JSON and YAML
+// are indented
+func EncodeConfig(format string, fields map[string]interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	switch format {
+	case FormatJSON:
+		b, err := json.MarshalIndent(fields, "", "    ")
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(append(b, '\n'))
+	case FormatYAML:
+		enc := yaml.NewEncoder(&buf)
+		enc.SetIndent(2)
+		if err := enc.Encode(fields); err != nil {
+			return nil, err
+		}
+		enc.Close()
+	case FormatTOML:
+		if err := toml.NewEncoder(&buf).Encode(integers(fields)); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown config format %v", format)
+	}
+	return buf.Bytes(), nil
+}
+
+// integers converts whole JSON numbers to int64, so TOML does not write
+// them as floats
+func integers(v interface{}) interface{} {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		converted := make(map[string]interface{}, len(value))
+		for k, item := range value {
+			converted[k] = integers(item)
+		}
+		return converted
+	case []interface{}:
+		converted := make([]interface{}, len(value))
+		for i, item := range value {
+			converted[i] = integers(item)
+		}
+		return converted
+	case float64:
+		if value == math.Trunc(value) && math.Abs(value) < 1<<53 {
+			return int64(value)
+		}
+	}
+	return v
+}
+
+// configFile returns the first existing file of the path without or with
+// one of the config extensions
+func configFile(path string) string {
+	if path == "" {
+		return ""
+	}
+	for _, ext := range configExtensions {
+		if info, err := os.Stat(path + ext); err == nil && !info.IsDir() {
+			return path + ext
+		}
+	}
+	return ""
+}
+
+// fileFormat returns the format of an existing config file or, for new
+// files, the format of the extension with JSON as default
+func fileFormat(path string) string {
+	if raw, err := os.ReadFile(path); err == nil {
+		return DetectFormat(path, raw)
+	}
+	if format := FormatByExtension(path); format != "" {
+		return format
+	}
+	return FormatJSON
+}
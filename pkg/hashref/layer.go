@@ -0,0 +1,199 @@
+package hashref
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Origins of config values that are not read from a file
+const (
+	OriginDefault = "default"
+	OriginEnv     = "env"
+	OriginFlag    = "flag"
+)
+
+// SystemConfigPath is the system wide config layer
+var SystemConfigPath = "/etc/hashref/config"
+
+// ConfigLayers returns the existing config files in the order they are
+// applied: the system config, the user config in XDG_CONFIG_HOME
+// (default: ~/.config/hashref/config), ~/.hashref and the nearest .hashref
+// of the working directory or its parents. Each of them may have a
+// .yaml, .yml, .toml or .json extension. A provided config file replaces
+// the user configs and the project config.
+func ConfigLayers(cfgFileName string) []string {
+	candidates := []string{configFile(SystemConfigPath), cfgFileName}
+	if cfgFileName == "" {
+		candidates = []string{configFile(SystemConfigPath), configFile(xdgConfigPath()), configFile(ConfigPath("")), projectConfigPath()}
+	}
+
+	layers := []string{}
+	seen := map[string]bool{}
+	for _, path := range candidates {
+		if path == "" || seen[path] {
+			continue
+		}
+		seen[path] = true
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			layers = append(layers, path)
+		}
+	}
+	return layers
+}
+
+// ConfigPath returns the provided path or ~/.hashref
+func ConfigPath(cfgFileName string) string {
+	if len(cfgFileName) > 0 {
+		return cfgFileName
+	}
+	dirname, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dirname, ".hashref")
+}
+
+// UserConfigPath returns the config file edited by the config commands:
+// the provided path, the loaded user config that is applied last, i.e.
+// ~/.hashref or the XDG config with any config extension, or ~/.hashref
+// if there is no user config yet
+func UserConfigPath(cfgFileName string) string {
+	if len(cfgFileName) > 0 {
+		return cfgFileName
+	}
+	for _, path := range []string{ConfigPath(""), xdgConfigPath()} {
+		if existing := configFile(path); existing != "" {
+			return existing
+		}
+	}
+	return ConfigPath("")
+}
+
+// xdgConfigPath returns the user config below XDG_CONFIG_HOME
+func xdgConfigPath() string {
+	dirname := os.Getenv("XDG_CONFIG_HOME")
+	if dirname == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dirname = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dirname, "hashref", "config")
+}
+
+// projectConfigPath searches .hashref from the working directory upwards,
+// the search stops below the home directory to skip the user config
+func projectConfigPath() string {
+	dirname, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+	home, _ := os.UserHomeDir()
+	for {
+		if home != "" && dirname == filepath.Clean(home) {
+			return ""
+		}
+		if path := configFile(filepath.Join(dirname, ".hashref")); path != "" {
+			return filepath.Clean(path)
+		}
+		parent := filepath.Dir(dirname)
+		if parent == dirname {
+			return ""
+		}
+		dirname = parent
+	}
+}
+
+// projectKeys are the fields a project config may set. A project config
+// comes with the checked out repository, fields that select the server,
+// credentials or commands would hand them to the repository author.
+var projectKeys = map[string]bool{
+	"HASHREF_PUBLISHER":      true,
+	"HASHREF_DEFAULT_META":   true,
+	"HASHREF_REQUIRE_SIGNED": true,
+	"HASHREF_GIT_PROVENANCE": true,
+	"HASHREF_COLLECTORS":     true,
+	ProfileEnv:               true,
+	"HASHREF_PROFILES":       true,
+}
+
+// envTemplate matches DefaultMeta templates that read the environment
+var envTemplate = regexp.MustCompile(`{{.*\benv\b.*}}`)
+
+// checkProjectFields rejects fields of a project config that are not in
+// projectKeys, including the fields of its profiles, and DefaultMeta
+// templates that could publish environment variables such as tokens
+func checkProjectFields(fields map[string]interface{}) error {
+	var errs []string
+	check := func(prefix string, fields map[string]interface{}) {
+		for key, value := range fields {
+			if !projectKeys[key] {
+				errs = append(errs, fmt.Sprintf("%v%v is not allowed in a project config", prefix, key))
+				continue
+			}
+			if meta, ok := value.(map[string]interface{}); ok && key == "HASHREF_DEFAULT_META" {
+				for entry, v := range meta {
+					if envTemplate.MatchString(fmt.Sprint(v)) {
+						errs = append(errs, fmt.Sprintf("%v%v %v: env is not allowed in a project config", prefix, key, entry))
+					}
+				}
+			}
+		}
+	}
+	check("", fields)
+	if profiles, ok := fields["HASHREF_PROFILES"].(map[string]interface{}); ok {
+		for name, profile := range profiles {
+			if p, ok := profile.(map[string]interface{}); ok {
+				check(fmt.Sprintf("profile %v: ", name), p)
+			}
+		}
+	}
+	if len(errs) > 0 {
+		sort.Strings(errs)
+		return fmt.Errorf("%v", strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+// SetOrigin records where the value of the config field was set
+func (c *Config) SetOrigin(key, origin string) {
+	if c.origins == nil {
+		c.origins = map[string]string{}
+	}
+	c.origins[key] = origin
+}
+
+// Origin returns where the value of the config field was set
+func (c Config) Origin(key string) string {
+	if origin, ok := c.origins[key]; ok {
+		return origin
+	}
+	return OriginDefault
+}
+
+// Fields returns the config as map of json field names to values
+func (c Config) Fields() map[string]interface{} {
+	fields := map[string]interface{}{}
+	b, err := json.Marshal(c)
+	if err != nil {
+		return fields
+	}
+	json.Unmarshal(b, &fields)
+	return fields
+}
+
+// FieldNames returns the sorted json field names of the config
+func (c Config) FieldNames() []string {
+	names := []string{}
+	for name := range c.Fields() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,269 @@
+package hashref
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+const (
+	StatusUnchanged Status = "unchanged"
+	StatusModified  Status = "modified"
+	StatusAdded     Status = "added"
+	StatusMissing   Status = "missing"
+)
+
+// LockVersion is the version of the lock file format
+const LockVersion = 1
+
+// DefaultLockKeys are the metadata keys recorded in a lock file if no
+// keys are requested
+var DefaultLockKeys = []string{"permission", "size"}
+
+// LockFile lists files with their expected hash and selected metadata.
+// Paths are relative to the directory of the lock file and always use
+// forward slashes.
+type LockFile struct {
+	Version int                  `json:"version"`
+	Roots   []string             `json:"roots"`
+	Keys    []string             `json:"keys"`
+	Files   map[string]LockEntry `json:"files"`
+}
+
+// LockEntry is the expected state of a single file
+type LockEntry struct {
+	Hash string                 `json:"hash"`
+	Meta map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// LoadLockFile reads a lock file from disk
+func LoadLockFile(path string) (LockFile, error) {
+	lock := LockFile{}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return lock, err
+	}
+	if err := json.Unmarshal(raw, &lock); err != nil {
+		return lock, fmt.Errorf("could not parse lock file %v: %v", path, err)
+	}
+	if lock.Version != LockVersion {
+		return lock, fmt.Errorf("unsupported lock file version %v", lock.Version)
+	}
+	return lock, nil
+}
+
+// Write stores the lock file as indented JSON
+func (l LockFile) Write(path string) error {
+	b, err := json.MarshalIndent(l, "", "    ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(b, '\n'), 0644)
+}
+
+// CreateLock hashes all regular files below the roots and records the
+// hash and the requested metadata keys. The roots are relative to the
+// working directory and are stored relative to the lock file.
+func (hc *HashrefClient) CreateLock(lockPath string, roots []string, keys []string) (LockFile, error) {
+	if len(keys) == 0 {
+		keys = DefaultLockKeys
+	}
+	lock := LockFile{
+		Version: LockVersion,
+		Keys:    keys,
+		Files:   map[string]LockEntry{},
+	}
+	base := filepath.Dir(lockPath)
+	for _, root := range roots {
+		rel, err := relativePath(base, root)
+		if err != nil {
+			return lock, err
+		}
+		lock.Roots = append(lock.Roots, rel)
+	}
+	files, err := collectFiles(lockPath, lock.Roots)
+	if err != nil {
+		return lock, err
+	}
+	for _, rel := range files {
+		entry, err := hc.lockEntry(base, rel, keys)
+		if err != nil {
+			return lock, err
+		}
+		lock.Files[rel] = entry
+	}
+	return lock, nil
+}
+
+// VerifyLock recomputes the files of the lock file and returns a result
+// per file with the status unchanged, modified, added or missing
+func (hc *HashrefClient) VerifyLock(lockPath string, lock LockFile) ([]Result, error) {
+	base := filepath.Dir(lockPath)
+	files, err := collectFiles(lockPath, lock.Roots)
+	if err != nil {
+		return nil, err
+	}
+
+	// Track which locked files still exist
+	seen := map[string]bool{}
+	var results []Result
+	for _, rel := range files {
+		seen[rel] = true
+		actual, err := hc.lockEntry(base, rel, lock.Keys)
+		if err != nil {
+			return nil, err
+		}
+		r := Result{
+			Input:  rel,
+			Type:   Lookup[File],
+			Hash:   actual.Hash,
+			Status: StatusUnchanged,
+			Meta:   actual.Meta,
+		}
+		expected, ok := lock.Files[rel]
+		switch {
+		case !ok:
+			r.Status = StatusAdded
+		case len(changedKeys(expected, actual)) > 0:
+			r.Status = StatusModified
+			r.Meta = map[string]interface{}{
+				"changed":  changedKeys(expected, actual),
+				"expected": expected,
+				"actual":   actual,
+			}
+		}
+		results = append(results, r)
+	}
+
+	// Report locked files that disappeared
+	var missing []string
+	for rel := range lock.Files {
+		if !seen[rel] {
+			missing = append(missing, rel)
+		}
+	}
+	sort.Strings(missing)
+	for _, rel := range missing {
+		results = append(results, Result{
+			Input:  rel,
+			Type:   Lookup[File],
+			Hash:   lock.Files[rel].Hash,
+			Status: StatusMissing,
+		})
+	}
+	return results, nil
+}
+
+// lockEntry hashes a single file and selects the metadata keys, only the
+// collectors that provide the keys are run
+func (hc *HashrefClient) lockEntry(base, rel string, keys []string) (LockEntry, error) {
+	path := filepath.Join(base, filepath.FromSlash(rel))
+	inputType, hash := GetHashTypeAndValue(path)
+	if inputType != File {
+		return LockEntry{}, fmt.Errorf("could not read %v", path)
+	}
+	entry := LockEntry{Hash: hash, Meta: map[string]interface{}{}}
+	meta := hc.collectMetadata(inputType, path, hash, providers(hc.collectors(), keys))
+	for _, k := range keys {
+		if v, ok := meta[k]; ok {
+			entry.Meta[k] = v
+		}
+	}
+	return entry, nil
+}
+
+// changedKeys returns "hash" and the metadata keys that differ
+func changedKeys(expected, actual LockEntry) []string {
+	var changed []string
+	if expected.Hash != actual.Hash {
+		changed = append(changed, "hash")
+	}
+	keys := map[string]bool{}
+	for k := range expected.Meta {
+		keys[k] = true
+	}
+	for k := range actual.Meta {
+		keys[k] = true
+	}
+	var sorted []string
+	for k := range keys {
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+	for _, k := range sorted {
+		if fmt.Sprint(expected.Meta[k]) != fmt.Sprint(actual.Meta[k]) {
+			changed = append(changed, k)
+		}
+	}
+	return changed
+}
+
+// relativePath returns path relative to base with forward slashes
+func relativePath(base, path string) (string, error) {
+	absBase, err := filepath.Abs(base)
+	if err != nil {
+		return "", err
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(absBase, absPath)
+	return filepath.ToSlash(rel), err
+}
+
+// collectFiles returns the sorted slash separated paths, relative to the
+// directory of the lock file, of all regular files below the roots. The
+// .git directories and the lock file itself are skipped, roots that do not
+// exist contain no files.
+func collectFiles(lockPath string, roots []string) ([]string, error) {
+	base := filepath.Dir(lockPath)
+	lockRel, err := relativePath(base, lockPath)
+	if err != nil {
+		return nil, err
+	}
+	found := map[string]bool{}
+	for _, root := range roots {
+		start := filepath.Join(base, filepath.FromSlash(root))
+		err := filepath.WalkDir(start, func(path string, d fs.DirEntry, err error) error {
+			if err != nil && path == start && errors.Is(err, fs.ErrNotExist) {
+				return filepath.SkipDir
+			}
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				if d.Name() == ".git" {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !d.Type().IsRegular() {
+				return nil
+			}
+			rel, err := relativePath(base, path)
+			if err != nil {
+				return err
+			}
+			if rel != lockRel {
+				found[rel] = true
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	files := make([]string, 0, len(found))
+	for f := range found {
+		files = append(files, f)
+	}
+	sort.Strings(files)
+	log.Printf("Found %v files in %v\n", len(files), roots)
+	return files, nil
+}
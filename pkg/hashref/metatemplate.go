@@ -0,0 +1,126 @@
+package hashref
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// MetaVars are the variables of DefaultMeta templates, evaluated per
+// input at publish time
+type MetaVars struct {
+	Input     string    // input as provided
+	Type      string    // file, text, hash or publisher
+	Hash      string    // SHA-256 of the input
+	Path      string    // absolute path of a file input
+	RelPath   string    // path of a file input relative to the working directory
+	Dir       string    // directory of Path
+	Base      string    // file name of Path
+	Ext       string    // extension of Path
+	Hostname  string    // name of the host
+	User      string    // name of the user running hashref
+	Publisher string    // configured publisher
+	Server    string    // configured server
+	Profile   string    // selected profile
+	OS        string    // operating system, e.g. linux
+	Arch      string    // architecture, e.g. amd64
+	Now       time.Time // time of publishing
+}
+
+// MetaFuncs are the functions of DefaultMeta templates
+var MetaFuncs = template.FuncMap{
+	"env": os.Getenv,
+	"default": func(def string, value interface{}) interface{} {
+		if value == nil || fmt.Sprint(value) == "" {
+			return def
+		}
+		return value
+	},
+	"lower":   strings.ToLower,
+	"upper":   strings.ToUpper,
+	"trim":    strings.TrimSpace,
+	"replace": strings.ReplaceAll,
+	"formatTime": func(layout string, t time.Time) string {
+		return t.Format(layout)
+	},
+}
+
+// isMetaTemplate reports if a DefaultMeta value needs to be evaluated
+func isMetaTemplate(value string) bool {
+	return strings.Contains(value, "{{")
+}
+
+// parseMetaTemplate parses a DefaultMeta value, unknown fields are errors
+func parseMetaTemplate(key, value string) (*template.Template, error) {
+	tmpl, err := template.New(key).Funcs(MetaFuncs).Option("missingkey=error").Parse(value)
+	if err != nil {
+		return nil, fmt.Errorf("HASHREF_DEFAULT_META %v: %v", key, err)
+	}
+	return tmpl, nil
+}
+
+// NewMetaVars returns the template variables of an input
+func (c Config) NewMetaVars(inputType HashType, input, hash string) MetaVars {
+	vars := MetaVars{
+		Input:     input,
+		Type:      Lookup[inputType],
+		Hash:      hash,
+		Publisher: c.Publisher,
+		Server:    c.HashrefServer,
+		Profile:   c.Profile,
+		OS:        runtime.GOOS,
+		Arch:      runtime.GOARCH,
+		Now:       time.Now(),
+	}
+	vars.Hostname, _ = os.Hostname()
+	if u, err := user.Current(); err == nil {
+		vars.User = u.Username
+	}
+	if inputType == File {
+		if abs, err := filepath.Abs(input); err == nil {
+			vars.Path = abs
+			vars.Dir = filepath.Dir(abs)
+			vars.Base = filepath.Base(abs)
+			vars.Ext = filepath.Ext(abs)
+			if wd, err := os.Getwd(); err == nil {
+				if rel, err := filepath.Rel(wd, abs); err == nil {
+					vars.RelPath = filepath.ToSlash(rel)
+				}
+			}
+		}
+	}
+	return vars
+}
+
+// ExpandDefaultMeta returns the DefaultMeta of the config with evaluated
+// templates for the input, values without template are copied verbatim
+func (c Config) ExpandDefaultMeta(inputType HashType, input, hash string) (map[string]interface{}, error) {
+	meta := make(map[string]interface{}, len(c.DefaultMeta))
+	var vars *MetaVars
+	for k, v := range c.DefaultMeta {
+		if !isMetaTemplate(v) {
+			meta[k] = v
+			continue
+		}
+		tmpl, err := parseMetaTemplate(k, v)
+		if err != nil {
+			return nil, err
+		}
+		if vars == nil {
+			mv := c.NewMetaVars(inputType, input, hash)
+			vars = &mv
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, vars); err != nil {
+			return nil, fmt.Errorf("HASHREF_DEFAULT_META %v: %v", k, err)
+		}
+		meta[k] = buf.String()
+	}
+	return meta, nil
+}
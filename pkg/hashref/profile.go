@@ -0,0 +1,88 @@
+package hashref
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// ProfileEnv selects the profile if no profile is provided explicitly
+const ProfileEnv = "HASHREF_PROFILE"
+
+// Profile holds config fields that overwrite the top level fields of
+// the config, fields that are not set are inherited
+type Profile map[string]interface{}
+
+// ApplyProfile overlays the named profile on the config. Without name
+// HASHREF_PROFILE and then the current profile of the config are used,
+// without any profile the config is not changed.
+func (c *Config) ApplyProfile(name string) error {
+	origin := c.Origin(ProfileEnv)
+	switch {
+	case name != "":
+		origin = OriginFlag
+	case os.Getenv(ProfileEnv) != "":
+		name = os.Getenv(ProfileEnv)
+		origin = OriginEnv
+	default:
+		name = c.Profile
+	}
+	if name == "" {
+		return nil
+	}
+	profile, ok := c.Profiles[name]
+	if !ok {
+		return fmt.Errorf("unknown profile %q, available: %v", name, c.ProfileNames())
+	}
+
+	// Profiles cannot select or define other profiles
+	fields := Profile{}
+	for k, v := range profile {
+		if k != ProfileEnv && k != "HASHREF_PROFILES" {
+			fields[k] = v
+		}
+	}
+	b, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(b, c); err != nil {
+		return fmt.Errorf("invalid profile %v: %v", name, err)
+	}
+	for key := range fields {
+		c.SetOrigin(key, fmt.Sprintf("profile %v", name))
+	}
+	c.Profile = name
+	c.SetOrigin(ProfileEnv, origin)
+	return nil
+}
+
+// ProfileNames returns the sorted names of all profiles
+func (c Config) ProfileNames() []string {
+	names := []string{}
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// AsProfile returns a config file content with all fields of the
+// config in a profile with the name that is the current profile
+func (c Config) AsProfile(name string) (map[string]interface{}, error) {
+	c.Profile = ""
+	c.Profiles = nil
+	b, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	profile := Profile{}
+	if err := json.Unmarshal(b, &profile); err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		ProfileEnv:         name,
+		"HASHREF_PROFILES": map[string]Profile{name: profile},
+	}, nil
+}
@@ -0,0 +1,46 @@
+package hashref
+
+import (
+	"sort"
+)
+
+// PublisherEntries returns the metadata of a lookup result per publisher.
+// The server groups the metadata of several publishers as objects below
+// "publishers", metadata of a single publisher names the publisher in
+// "publisher" or "user". Metadata without publisher information is
+// returned as entry of an empty publisher name.
+func PublisherEntries(meta map[string]interface{}) map[string]map[string]interface{} {
+	entries := map[string]map[string]interface{}{}
+	if len(meta) == 0 {
+		return entries
+	}
+	if publishers, ok := meta["publishers"].(map[string]interface{}); ok {
+		for name, v := range publishers {
+			if entry, ok := v.(map[string]interface{}); ok {
+				entries[name] = entry
+			}
+		}
+		return entries
+	}
+	for _, key := range []string{"publisher", "user"} {
+		if name, ok := meta[key].(string); ok && name != "" {
+			entries[name] = meta
+			return entries
+		}
+	}
+	entries[""] = meta
+	return entries
+}
+
+// PublisherNames returns the sorted names of the publishers that
+// provided metadata
+func PublisherNames(meta map[string]interface{}) []string {
+	names := []string{}
+	for name := range PublisherEntries(meta) {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
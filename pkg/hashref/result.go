@@ -0,0 +1,92 @@
+package hashref
+
+import (
+	"fmt"
+	"net/http"
+)
+
+type Status string
+
+const (
+	StatusFound      Status = "found"
+	StatusNotFound   Status = "not_found"
+	StatusSet        Status = "set"
+	StatusNotSet     Status = "not_set"
+	StatusRemoved    Status = "removed"
+	StatusNotRemoved Status = "not_removed"
+	StatusError      Status = "error"
+)
+
+// Result is the outcome of processing a single input and the stable
+// schema used by all machine readable output formats
+type Result struct {
+	Input  string                 `json:"input" yaml:"input"`
+	Type   string                 `json:"type" yaml:"type"`
+	Hash   string                 `json:"hash" yaml:"hash"`
+	Status Status                 `json:"status" yaml:"status"`
+	Code   int                    `json:"code,omitempty" yaml:"code,omitempty"`
+	Error  string                 `json:"error,omitempty" yaml:"error,omitempty"`
+	Meta   map[string]interface{} `json:"metadata,omitempty" yaml:"metadata,omitempty"`
+
+	Aggregation *Aggregation `json:"aggregation,omitempty" yaml:"aggregation,omitempty"`
+	Violations  []Violation  `json:"violations,omitempty" yaml:"violations,omitempty"`
+}
+
+// Violation names a policy rule that matched a result
+type Violation struct {
+	Rule    string `json:"rule" yaml:"rule"`
+	Action  string `json:"action" yaml:"action"`
+	Message string `json:"message,omitempty" yaml:"message,omitempty"`
+}
+
+// NewResult converts the return values of a client request into a
+// Result. On success the status is ok and the returned map is kept as
+// metadata, otherwise the status is failed and the error details of the
+// map are extracted.
+func NewResult(inputType HashType, input, hash string, success bool, meta map[string]interface{}, ok, failed Status) Result {
+	r := Result{
+		Input:  input,
+		Type:   Lookup[inputType],
+		Hash:   hash,
+		Status: ok,
+	}
+	if success {
+		r.Meta = meta
+		return r
+	}
+	r.Status = failed
+	if code, ok := meta["code"].(int); ok {
+		r.Code = code
+	}
+	if e, ok := meta["error"]; ok {
+		r.Error = fmt.Sprintf("%v", e)
+	} else if s, ok := meta["status"]; ok {
+		r.Error = fmt.Sprintf("%v", s)
+	}
+	return r
+}
+
+// NewLookupResult converts the return values of GetRemoteData and
+// GetRemoteDataFromPublisher into a Result
+func NewLookupResult(inputType HashType, input, hash string, success bool, meta map[string]interface{}) Result {
+	r := NewResult(inputType, input, hash, success, meta, StatusFound, StatusError)
+
+	// Distinguish between unknown hashes and failed requests
+	if r.Code == http.StatusNotFound {
+		r.Status = StatusNotFound
+		r.Error = ""
+	}
+	return r
+}
+
+// Failed reports if the request for the result failed on the server
+// or the network
+func (r Result) Failed() bool {
+	return r.Error != ""
+}
+
+// Unauthorized reports if the server rejected the request for the
+// result due to missing or wrong credentials
+func (r Result) Unauthorized() bool {
+	return r.Code == http.StatusUnauthorized || r.Code == http.StatusForbidden
+}
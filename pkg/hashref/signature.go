@@ -0,0 +1,146 @@
+package hashref
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"log"
+	"os"
+)
+
+// SignatureKey is the metadata key that holds the signature of the
+// remaining metadata
+const SignatureKey = "_signature"
+
+// SignatureAlgorithm is the only supported signature algorithm
+const SignatureAlgorithm = "ed25519"
+
+// GenerateKey creates an Ed25519 key pair, stores the private key PEM
+// encoded at path and the base64 encoded public key at path.pub. The
+// public key is returned base64 encoded.
+func GenerateKey(path string) (string, error) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return "", err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		return "", err
+	}
+	block := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if err := os.WriteFile(path, block, 0600); err != nil {
+		return "", err
+	}
+	encoded := base64.StdEncoding.EncodeToString(pub)
+	if err := os.WriteFile(path+".pub", []byte(encoded+"\n"), 0644); err != nil {
+		return "", err
+	}
+	log.Printf("Key pair written to %v\n", path)
+	return encoded, nil
+}
+
+// LoadSigningKey reads a PEM encoded Ed25519 private key
+func LoadSigningKey(path string) (ed25519.PrivateKey, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(raw)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data in %v", path)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	priv, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%v is not an Ed25519 key", path)
+	}
+	return priv, nil
+}
+
+// PublicKeyString returns the base64 encoding of the public key
+func PublicKeyString(priv ed25519.PrivateKey) string {
+	return base64.StdEncoding.EncodeToString(priv.Public().(ed25519.PublicKey))
+}
+
+// CanonicalPayload returns the bytes that are signed for metadata of a
+// hash: the compact JSON encoding of {"hash": hash, "metadata": metadata}
+// with sorted keys and without HTML escaping. The signature itself is
+// not part of the payload.
+func CanonicalPayload(hash string, metadata map[string]interface{}) ([]byte, error) {
+	unsigned := make(map[string]interface{}, len(metadata))
+	for k, v := range metadata {
+		if k != SignatureKey {
+			unsigned[k] = v
+		}
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(map[string]interface{}{"hash": hash, "metadata": unsigned}); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// SignMetadata returns a copy of the metadata with the signature of the
+// canonical payload stored below SignatureKey
+func SignMetadata(priv ed25519.PrivateKey, hash string, metadata map[string]interface{}) (map[string]interface{}, error) {
+	payload, err := CanonicalPayload(hash, metadata)
+	if err != nil {
+		return nil, err
+	}
+	signed := make(map[string]interface{}, len(metadata)+1)
+	for k, v := range metadata {
+		signed[k] = v
+	}
+	signed[SignatureKey] = map[string]interface{}{
+		"algorithm":  SignatureAlgorithm,
+		"public_key": PublicKeyString(priv),
+		"signature":  base64.StdEncoding.EncodeToString(ed25519.Sign(priv, payload)),
+	}
+	return signed, nil
+}
+
+// signingKey loads the configured signing key once, without configured
+// key nil is returned
+func (hc *HashrefClient) signingKey() (ed25519.PrivateKey, error) {
+	if hc.config.SigningKey == "" {
+		return nil, nil
+	}
+	if hc.privateKey == nil {
+		key, err := LoadSigningKey(hc.config.SigningKey)
+		if err != nil {
+			return nil, fmt.Errorf("could not load signing key: %v", err)
+		}
+		hc.privateKey = key
+	}
+	return hc.privateKey, nil
+}
+
+// PublicKey returns the base64 encoded public key of the configured
+// signing key or an empty string
+func (hc *HashrefClient) PublicKey() (string, error) {
+	key, err := hc.signingKey()
+	if err != nil || key == nil {
+		return "", err
+	}
+	return PublicKeyString(key), nil
+}
+
+// sign adds the signature to the metadata if a signing key is configured
+func (hc *HashrefClient) sign(hash string, metadata map[string]interface{}) (map[string]interface{}, error) {
+	key, err := hc.signingKey()
+	if err != nil || key == nil {
+		return metadata, err
+	}
+	log.Printf("Sign metadata for %v\n", hash)
+	return SignMetadata(key, hash, metadata)
+}
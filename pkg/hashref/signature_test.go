@@ -0,0 +1,213 @@
+package hashref
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+func testKey(t *testing.T) ed25519.PrivateKey {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return priv
+}
+
+func TestCanonicalPayload(t *testing.T) {
+	payload, err := CanonicalPayload("abc", map[string]interface{}{
+		"z":          "<&>",
+		"a":          1,
+		SignatureKey: map[string]interface{}{"signature": "x"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"hash":"abc","metadata":{"a":1,"z":"<&>"}}`; string(payload) != want {
+		t.Errorf("CanonicalPayload() = %s, want %s", payload, want)
+	}
+}
+
+func TestVerifyMetadata(t *testing.T) {
+	priv := testKey(t)
+	other := testKey(t)
+	signed, err := SignMetadata(priv, "abc", map[string]interface{}{"verdict": "good", "tags": []interface{}{"a"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		key    string
+		hash   string
+		tamper func(meta map[string]interface{})
+		want   string
+	}{
+		{"valid", PublicKeyString(priv), "abc", func(meta map[string]interface{}) {}, Verified},
+		{"tampered metadata", PublicKeyString(priv), "abc", func(meta map[string]interface{}) { meta["verdict"] = "bad" }, Invalid},
+		{"added metadata", PublicKeyString(priv), "abc", func(meta map[string]interface{}) { meta["extra"] = true }, Invalid},
+		{"removed metadata", PublicKeyString(priv), "abc", func(meta map[string]interface{}) { delete(meta, "tags") }, Invalid},
+		{"other hash", PublicKeyString(priv), "abd", func(meta map[string]interface{}) {}, Invalid},
+		{"wrong key", PublicKeyString(other), "abc", func(meta map[string]interface{}) {}, Invalid},
+		{"replaced key", PublicKeyString(other), "abc", func(meta map[string]interface{}) {
+			meta[SignatureKey].(map[string]interface{})["public_key"] = PublicKeyString(other)
+		}, Invalid},
+		{"other algorithm", PublicKeyString(priv), "abc", func(meta map[string]interface{}) {
+			meta[SignatureKey].(map[string]interface{})["algorithm"] = "rsa"
+		}, Invalid},
+		{"invalid signature encoding", PublicKeyString(priv), "abc", func(meta map[string]interface{}) {
+			meta[SignatureKey].(map[string]interface{})["signature"] = "!"
+		}, Invalid},
+		{"missing signature", PublicKeyString(priv), "abc", func(meta map[string]interface{}) { delete(meta, SignatureKey) }, Unverified},
+		{"malformed signature", PublicKeyString(priv), "abc", func(meta map[string]interface{}) { meta[SignatureKey] = "sig" }, Unverified},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// round trip through JSON like metadata from the server
+			raw, err := json.Marshal(signed)
+			if err != nil {
+				t.Fatal(err)
+			}
+			meta := map[string]interface{}{}
+			if err := json.Unmarshal(raw, &meta); err != nil {
+				t.Fatal(err)
+			}
+			tt.tamper(meta)
+			if got := VerifyMetadata(tt.key, tt.hash, meta); got != tt.want {
+				t.Errorf("VerifyMetadata() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadSigningKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "key")
+	pub, err := GenerateKey(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	priv, err := LoadSigningKey(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if PublicKeyString(priv) != pub {
+		t.Errorf("public key of loaded key = %v, want %v", PublicKeyString(priv), pub)
+	}
+	if _, err := LoadSigningKey(path + ".pub"); err == nil {
+		t.Error("LoadSigningKey() of the public key succeeded, want error")
+	}
+}
+
+// selfServer serves the self record of alice signed with the current key
+func selfServer(t *testing.T, key *ed25519.PrivateKey) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		publisherHash := CalculateHash([]byte("alice"))
+		if req.URL.Path != "/api/publisher/"+publisherHash {
+			http.NotFound(w, req)
+			return
+		}
+		record, err := SignMetadata(*key, publisherHash, map[string]interface{}{
+			"publisher":  "alice",
+			"public_key": PublicKeyString(*key),
+		})
+		if err != nil {
+			t.Error(err)
+		}
+		json.NewEncoder(w).Encode(record)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestKeyPinning(t *testing.T) {
+	first := testKey(t)
+	second := testKey(t)
+	current := first
+	srv := selfServer(t, &current)
+
+	config := NewConfig()
+	config.HashrefServer = srv.URL
+	config.Keyring = filepath.Join(t.TempDir(), "keyring")
+
+	verify := func(key ed25519.PrivateKey) string {
+		t.Helper()
+		signed, err := SignMetadata(key, "abc", map[string]interface{}{"verdict": "good"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		meta := map[string]interface{}{"publishers": map[string]interface{}{"alice": signed}}
+		hc := NewClient(config)
+		hc.verifySignatures(meta, "abc", "")
+		state, _ := signed[VerificationKey].(string)
+		return state
+	}
+
+	// First use pins the key of the self record
+	if state := verify(first); state != Verified {
+		t.Errorf("first use: %v, want %v", state, Verified)
+	}
+	keyring, err := LoadKeyring(config.Keyring)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keyring["alice"] != PublicKeyString(first) {
+		t.Errorf("pinned key = %q, want %q", keyring["alice"], PublicKeyString(first))
+	}
+
+	// The pinned key is used even if the publisher announces a new key
+	current = second
+	if state := verify(second); state != Invalid {
+		t.Errorf("after key change: %v, want %v", state, Invalid)
+	}
+	if state := verify(first); state != Verified {
+		t.Errorf("pinned key after key change: %v, want %v", state, Verified)
+	}
+
+	// A configured key takes precedence over the keyring
+	config.TrustedPublishers = []TrustedPublisher{{Name: "alice", Key: PublicKeyString(second)}}
+	if state := verify(second); state != Verified {
+		t.Errorf("configured key: %v, want %v", state, Verified)
+	}
+}
+
+func TestRequireSigned(t *testing.T) {
+	priv := testKey(t)
+	signed, err := SignMetadata(priv, "abc", map[string]interface{}{"verdict": "good"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := NewConfig()
+	config.RequireSigned = true
+	config.TrustedPublishers = []TrustedPublisher{{Name: "alice", Key: PublicKeyString(priv)}}
+	hc := NewClient(config)
+
+	meta := map[string]interface{}{"publishers": map[string]interface{}{
+		"alice": signed,
+		"bob":   map[string]interface{}{"verdict": "bad"},
+	}}
+	if !hc.verifySignatures(meta, "abc", "") {
+		t.Error("verifySignatures() = false with verified entry")
+	}
+	if publishers := meta["publishers"].(map[string]interface{}); len(publishers) != 1 || publishers["alice"] == nil {
+		t.Errorf("publishers after verification = %v, want only alice", publishers)
+	}
+
+	unsigned := map[string]interface{}{"publishers": map[string]interface{}{"bob": map[string]interface{}{"verdict": "bad"}}}
+	if hc.verifySignatures(unsigned, "abc", "") {
+		t.Error("verifySignatures() = true without verified entry")
+	}
+}
@@ -0,0 +1,185 @@
+package hashref
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Scopes of access tokens
+const (
+	ScopeRead    = "read"
+	ScopePublish = "publish"
+	ScopeDelete  = "delete"
+)
+
+// Scopes lists all known token scopes
+var Scopes = []string{ScopeRead, ScopePublish, ScopeDelete}
+
+// Token is an access token of a publisher. The secret token is only
+// returned once on creation.
+type Token struct {
+	ID      string   `json:"id" yaml:"id"`
+	Name    string   `json:"name" yaml:"name"`
+	Scopes  []string `json:"scopes" yaml:"scopes"`
+	Created string   `json:"created,omitempty" yaml:"created,omitempty"`
+	Expires string   `json:"expires,omitempty" yaml:"expires,omitempty"`
+	Token   string   `json:"token,omitempty" yaml:"token,omitempty"`
+}
+
+// Allows reports if the token grants all scopes
+func (t Token) Allows(scopes ...string) bool {
+	for _, scope := range scopes {
+		granted := false
+		for _, s := range t.Scopes {
+			granted = granted || s == scope
+		}
+		if !granted {
+			return false
+		}
+	}
+	return true
+}
+
+// Expired reports if the token is expired at the provided time, invalid
+// expiry dates are expired
+func (t Token) Expired(now time.Time) bool {
+	if t.Expires == "" {
+		return false
+	}
+	expires, err := time.Parse(time.RFC3339, t.Expires)
+	return err != nil || now.After(expires)
+}
+
+// RequiredScopes returns the scopes a token needs for a request: read
+// for lookups, delete for removals and publish otherwise. The token api
+// needs every scope, so tokens cannot create tokens with more scopes.
+func RequiredScopes(method, path string) []string {
+	if path == "/api/tokens" || strings.HasPrefix(path, "/api/tokens/") {
+		return Scopes
+	}
+	switch method {
+	case http.MethodGet, http.MethodHead:
+		return []string{ScopeRead}
+	case http.MethodDelete:
+		return []string{ScopeDelete}
+	default:
+		return []string{ScopePublish}
+	}
+}
+
+// ValidateScopes checks that all scopes are known
+func ValidateScopes(scopes []string) error {
+	if len(scopes) == 0 {
+		return fmt.Errorf("no scope provided")
+	}
+	for _, scope := range scopes {
+		known := false
+		for _, s := range Scopes {
+			known = known || s == scope
+		}
+		if !known {
+			return fmt.Errorf("unknown scope %q, use one of %v", scope, strings.Join(Scopes, ", "))
+		}
+	}
+	return nil
+}
+
+// ResponseError is returned if the server responds with an error status
+type ResponseError struct {
+	Code   int
+	Status string
+}
+
+func (e *ResponseError) Error() string {
+	return fmt.Sprintf("server responded %v", e.Status)
+}
+
+// Unauthorized reports if the server rejected the credentials
+func (e *ResponseError) Unauthorized() bool {
+	return e.Code == http.StatusUnauthorized || e.Code == http.StatusForbidden
+}
+
+// CreateToken requests a new token with the scopes, an expiry of zero
+// creates a token without expiration
+func (hc *HashrefClient) CreateToken(name string, scopes []string, expires time.Duration) (Token, error) {
+	if err := ValidateScopes(scopes); err != nil {
+		return Token{}, err
+	}
+	request := Token{Name: name, Scopes: scopes}
+	if expires > 0 {
+		request.Expires = time.Now().Add(expires).UTC().Format(time.RFC3339)
+	}
+	jsonData, err := json.Marshal(request)
+	if err != nil {
+		return Token{}, err
+	}
+	log.Printf("Create token %v with scopes %v\n", name, scopes)
+	body, err := hc.tokenRequest(http.MethodPost, "", jsonData)
+	if err != nil {
+		return Token{}, err
+	}
+	token := Token{}
+	if err := json.Unmarshal(body, &token); err != nil {
+		return Token{}, err
+	}
+	return token, nil
+}
+
+// ListTokens returns the tokens of the publisher without their secrets
+func (hc *HashrefClient) ListTokens() ([]Token, error) {
+	body, err := hc.tokenRequest(http.MethodGet, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	tokens := []Token{}
+	if err := json.Unmarshal(body, &tokens); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// RevokeToken deletes the token with the id
+func (hc *HashrefClient) RevokeToken(id string) error {
+	log.Printf("Revoke token %v\n", id)
+	_, err := hc.tokenRequest(http.MethodDelete, id, nil)
+	return err
+}
+
+// tokenRequest performs a request to the token api and returns the
+// response body
+func (hc *HashrefClient) tokenRequest(method, id string, jsonData []byte) ([]byte, error) {
+	requestUri := fmt.Sprintf("%v/api/tokens", hc.config.HashrefServer)
+	if id != "" {
+		requestUri = fmt.Sprintf("%v/%v", requestUri, url.PathEscape(id))
+	}
+	log.Printf("Request-uri: %v\n", requestUri)
+	req, err := hc.newRequest(method, requestUri, jsonData)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create Client
+	client := &http.Client{}
+
+	// Perform request
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 400 {
+		log.Printf("Response Status %v: %v\n", resp.StatusCode, resp.Status)
+		return nil, &ResponseError{Code: resp.StatusCode, Status: resp.Status}
+	}
+	return body, nil
+}
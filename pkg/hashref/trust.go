@@ -0,0 +1,86 @@
+package hashref
+
+import (
+	"log"
+	"net/http"
+	"sort"
+)
+
+const (
+	UntrustedShow = "show"
+	UntrustedHide = "hide"
+)
+
+// TrustKey is the metadata key of the trust annotation of a publisher entry
+const TrustKey = "_trust"
+
+// TrustedPublisher is a publisher whose metadata counts for lookups.
+// The level weights the publisher against other trusted publishers.
+type TrustedPublisher struct {
+	Name  string `json:"name"`
+	Key   string `json:"key,omitempty"`
+	Level int    `json:"level"`
+}
+
+// TrustedPublisher returns the trust configuration of a publisher
+func (c Config) TrustedPublisher(name string) (TrustedPublisher, bool) {
+	for _, tp := range c.TrustedPublishers {
+		if tp.Name == name {
+			return tp, true
+		}
+	}
+	return TrustedPublisher{}, false
+}
+
+// applyTrust annotates every publisher entry of the metadata with its
+// trust level and, if configured, removes untrusted entries. Without
+// trusted publishers the metadata is not changed. It reports false if
+// entries were hidden and no trusted entry remains.
+func (hc *HashrefClient) applyTrust(meta map[string]interface{}, publisher string) bool {
+	if len(hc.config.TrustedPublishers) == 0 {
+		return true
+	}
+	entries := PublisherEntries(meta)
+	if publisher != "" {
+		entries = map[string]map[string]interface{}{publisher: meta}
+	}
+
+	trusted := 0
+	publishers, grouped := meta["publishers"].(map[string]interface{})
+	for name, entry := range entries {
+		tp, ok := hc.config.TrustedPublisher(name)
+		if ok {
+			trusted++
+			entry[TrustKey] = map[string]interface{}{"trusted": true, "level": tp.Level}
+			continue
+		}
+		if hc.config.Untrusted == UntrustedHide && grouped {
+			log.Printf("Hide metadata of untrusted publisher %v\n", name)
+			delete(publishers, name)
+			continue
+		}
+		entry[TrustKey] = map[string]interface{}{"trusted": false, "level": 0}
+	}
+	return trusted > 0 || hc.config.Untrusted != UntrustedHide
+}
+
+// untrustedResponse is returned if all metadata of a lookup was hidden
+func untrustedResponse() map[string]interface{} {
+	return map[string]interface{}{
+		"status": "no metadata from trusted publishers",
+		"code":   http.StatusNotFound,
+	}
+}
+
+// TrustedPublisherNames returns the sorted names of the publishers that
+// provided metadata and are annotated as trusted
+func TrustedPublisherNames(meta map[string]interface{}) []string {
+	names := []string{}
+	for name, entry := range PublisherEntries(meta) {
+		if trust, ok := entry[TrustKey].(map[string]interface{}); ok && trust["trusted"] == true {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
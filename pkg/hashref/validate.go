@@ -0,0 +1,108 @@
+package hashref
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// ConfigKeys returns the sorted json names of all config fields
+func ConfigKeys() []string {
+	keys := []string{}
+	t := reflect.TypeOf(Config{})
+	for i := 0; i < t.NumField(); i++ {
+		if name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]; name != "" {
+			keys = append(keys, name)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// isConfigKey reports if the key is the json name of a config field
+func isConfigKey(key string) bool {
+	for _, k := range ConfigKeys() {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckKeys reports unknown keys of config file content, including the
+// keys of its profiles
+func CheckKeys(fields map[string]interface{}) error {
+	var errs []string
+	for key := range fields {
+		if !isConfigKey(key) {
+			errs = append(errs, fmt.Sprintf("unknown key %v", key))
+		}
+	}
+	if profiles, ok := fields["HASHREF_PROFILES"].(map[string]interface{}); ok {
+		for name, profile := range profiles {
+			entries, ok := profile.(map[string]interface{})
+			if !ok {
+				errs = append(errs, fmt.Sprintf("profile %v is not an object", name))
+				continue
+			}
+			for key := range entries {
+				if !isConfigKey(key) || key == ProfileEnv || key == "HASHREF_PROFILES" {
+					errs = append(errs, fmt.Sprintf("unknown key %v in profile %v", key, name))
+				}
+			}
+		}
+	}
+	if len(errs) > 0 {
+		sort.Strings(errs)
+		return fmt.Errorf("%v", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// Validate checks the values of the effective config
+func (c Config) Validate() error {
+	var errs []string
+	if strings.TrimSpace(c.Publisher) == "" {
+		errs = append(errs, "HASHREF_PUBLISHER is empty")
+	}
+	if u, err := url.Parse(c.HashrefServer); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		errs = append(errs, fmt.Sprintf("HASHREF_SERVER %q is not a http(s) URL", c.HashrefServer))
+	}
+	if c.Untrusted != UntrustedShow && c.Untrusted != UntrustedHide {
+		errs = append(errs, fmt.Sprintf("HASHREF_UNTRUSTED must be %v or %v", UntrustedShow, UntrustedHide))
+	}
+	for i, tp := range c.TrustedPublishers {
+		if tp.Name == "" {
+			errs = append(errs, fmt.Sprintf("HASHREF_TRUSTED_PUBLISHERS[%v] has no name", i))
+		}
+		if tp.Level < 0 {
+			errs = append(errs, fmt.Sprintf("HASHREF_TRUSTED_PUBLISHERS[%v] has a negative level", i))
+		}
+	}
+	for k, v := range c.DefaultMeta {
+		if !isMetaTemplate(v) {
+			continue
+		}
+		tmpl, err := parseMetaTemplate(k, v)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		if err := tmpl.Execute(io.Discard, c.NewMetaVars(Text, "", "")); err != nil {
+			errs = append(errs, fmt.Sprintf("HASHREF_DEFAULT_META %v: %v", k, err))
+		}
+	}
+	errs = append(errs, c.validateCollectors()...)
+	if c.Profile != "" {
+		if _, ok := c.Profiles[c.Profile]; !ok {
+			errs = append(errs, fmt.Sprintf("HASHREF_PROFILE %q is not defined", c.Profile))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid config: %v", strings.Join(errs, "; "))
+	}
+	return nil
+}
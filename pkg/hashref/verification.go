@@ -0,0 +1,215 @@
+package hashref
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+const (
+	Verified   = "verified"
+	Unverified = "unverified"
+	Invalid    = "invalid"
+)
+
+// VerificationKey is the metadata key of the verification annotation of
+// a publisher entry
+const VerificationKey = "_verification"
+
+// Keyring maps publisher names to their base64 encoded public keys
+type Keyring map[string]string
+
+// LoadKeyring reads a keyring, a missing file is an empty keyring
+func LoadKeyring(path string) (Keyring, error) {
+	keyring := Keyring{}
+	raw, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return keyring, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(raw, &keyring); err != nil {
+		return nil, fmt.Errorf("could not parse keyring %v: %v", path, err)
+	}
+	return keyring, nil
+}
+
+// Save writes the keyring as indented JSON
+func (k Keyring) Save(path string) error {
+	b, err := json.MarshalIndent(k, "", "    ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(b, '\n'), 0600)
+}
+
+// VerifyMetadata checks the signature of metadata of a hash against the
+// base64 encoded public key and returns verified, unverified (no
+// signature) or invalid
+func VerifyMetadata(publicKey, hash string, metadata map[string]interface{}) string {
+	sig, ok := metadata[SignatureKey].(map[string]interface{})
+	if !ok {
+		return Unverified
+	}
+	if sig["algorithm"] != SignatureAlgorithm || sig["public_key"] != publicKey {
+		return Invalid
+	}
+	pub, err := base64.StdEncoding.DecodeString(publicKey)
+	if err != nil || len(pub) != ed25519.PublicKeySize {
+		return Invalid
+	}
+	encoded, _ := sig["signature"].(string)
+	signature, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return Invalid
+	}
+	payload, err := CanonicalPayload(hash, metadata)
+	if err != nil || !ed25519.Verify(pub, payload, signature) {
+		return Invalid
+	}
+	return Verified
+}
+
+// keyringPath returns the configured keyring or ~/.hashref.keyring
+func (hc *HashrefClient) keyringPath() string {
+	if hc.config.Keyring != "" {
+		return hc.config.Keyring
+	}
+	dirname, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dirname, ".hashref.keyring")
+}
+
+// publisherKey returns the known public key of a publisher. Keys of
+// trusted publishers in the config take precedence over the keyring.
+// Unknown keys are fetched from the self record of the publisher and
+// pinned in the keyring on first use.
+func (hc *HashrefClient) publisherKey(name string) (string, error) {
+	if tp, ok := hc.config.TrustedPublisher(name); ok && tp.Key != "" {
+		return tp.Key, nil
+	}
+	if hc.keyring == nil {
+		keyring, err := LoadKeyring(hc.keyringPath())
+		if err != nil {
+			return "", err
+		}
+		hc.keyring = keyring
+	}
+	if key, ok := hc.keyring[name]; ok {
+		return key, nil
+	}
+
+	// Trust on first use
+	key, err := hc.fetchPublisherKey(name)
+	if err != nil || key == "" {
+		return "", err
+	}
+	log.Printf("Pin key of publisher %v: %v\n", name, key)
+	hc.keyring[name] = key
+	if path := hc.keyringPath(); path != "" {
+		if err := hc.keyring.Save(path); err != nil {
+			log.Printf("ERROR: %v\n", err)
+		}
+	}
+	return key, nil
+}
+
+// fetchPublisherKey requests the self record of a publisher and returns
+// its public key, if the record is signed the signature must match
+func (hc *HashrefClient) fetchPublisherKey(name string) (string, error) {
+	publisherHash := CalculateHash([]byte(name))
+	requestUri := fmt.Sprintf("%v/api/publisher/%v", hc.config.HashrefServer, publisherHash)
+	log.Printf("Request-uri: %v\n", requestUri)
+	req, err := hc.newRequest(http.MethodGet, requestUri, nil)
+	if err != nil {
+		return "", err
+	}
+
+	// Create Client
+	client := &http.Client{}
+
+	// Perform request
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode >= 400 {
+		log.Printf("Response Status %v: %v\n", resp.StatusCode, resp.Status)
+		return "", nil
+	}
+	remoteData := make(map[string]interface{})
+	if err := json.Unmarshal(body, &remoteData); err != nil {
+		return "", err
+	}
+
+	// The record may be grouped by publisher
+	record := remoteData
+	if entry, ok := PublisherEntries(remoteData)[name]; ok {
+		record = entry
+	}
+	key, _ := record["public_key"].(string)
+	if key == "" {
+		return "", nil
+	}
+	if _, signed := record[SignatureKey]; signed && VerifyMetadata(key, publisherHash, record) != Verified {
+		return "", fmt.Errorf("self record of publisher %v has an invalid signature", name)
+	}
+	return key, nil
+}
+
+// verifySignatures annotates every publisher entry of the metadata with
+// its verification state. With RequireSigned, entries that are not
+// verified are removed and false is reported if nothing remains.
+func (hc *HashrefClient) verifySignatures(meta map[string]interface{}, hash, publisher string) bool {
+	entries := PublisherEntries(meta)
+	if publisher != "" {
+		entries = map[string]map[string]interface{}{publisher: meta}
+	}
+
+	verified := 0
+	publishers, grouped := meta["publishers"].(map[string]interface{})
+	for name, entry := range entries {
+		state := Unverified
+		if _, signed := entry[SignatureKey]; signed {
+			key, err := hc.publisherKey(name)
+			if err != nil {
+				log.Printf("ERROR: %v\n", err)
+			}
+			if key != "" {
+				state = VerifyMetadata(key, hash, entry)
+			}
+		}
+		log.Printf("Metadata of publisher %v is %v\n", name, state)
+		if state == Verified {
+			verified++
+		} else if hc.config.RequireSigned && grouped {
+			delete(publishers, name)
+			continue
+		}
+		entry[VerificationKey] = state
+	}
+	return verified > 0 || !hc.config.RequireSigned
+}
+
+// unsignedResponse is returned if signed metadata is required but none
+// could be verified
+func unsignedResponse() map[string]interface{} {
+	return map[string]interface{}{
+		"status": "no verified metadata",
+		"code":   http.StatusNotFound,
+	}
+}
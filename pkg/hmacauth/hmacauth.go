@@ -0,0 +1,247 @@
+// Package hmacauth signs and verifies hashref requests with a secret
+// shared between a publisher and the server.
+//
+// The signature is the base64 encoded HMAC-SHA256 of the string
+//
+//	METHOD\nREQUEST-URI\nKEY-ID\nTIMESTAMP\nNONCE\nBODY-SHA256
+//
+// where the key id names the secret (the publisher), the timestamp is in
+// unix seconds, the nonce is random and the body hash is the hex encoded
+// SHA-256 of the request body. Key id, timestamp, nonce, body hash and
+// signature are sent as headers, so the Authorization header stays free
+// for tokens. The server side Verifier rejects requests outside of the
+// allowed clock skew, nonces it has already seen within that window and
+// requests whose Authorization names another publisher than the key id.
+// Behind the Middleware handlers get the verified key id with KeyID, the
+// owner of a Bearer token has to match it.
+package hmacauth
+
+import (
+	"bytes"
+	"container/heap"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	HeaderKeyID      = "X-Hashref-Key-Id"
+	HeaderTimestamp  = "X-Hashref-Timestamp"
+	HeaderNonce      = "X-Hashref-Nonce"
+	HeaderBodyHash   = "X-Hashref-Content-Sha256"
+	HeaderSignature  = "X-Hashref-Signature"
+	DefaultMaxSkew   = 5 * time.Minute
+	nonceSize        = 16
+	maxNonceCacheLen = 100000
+)
+
+var (
+	ErrMissingHeader = errors.New("missing signature headers")
+	ErrUnknownSecret = errors.New("no secret for key id")
+	ErrExpired       = errors.New("request timestamp outside of allowed skew")
+	ErrReplay        = errors.New("nonce was already used")
+	ErrBodyHash      = errors.New("body hash does not match")
+	ErrSignature     = errors.New("invalid signature")
+	ErrNonceCache    = errors.New("too many signed requests within the allowed skew")
+	ErrKeyMismatch   = errors.New("key id does not match the publisher")
+)
+
+// keyIDContext is the context key of the verified key id
+type keyIDContext struct{}
+
+// KeyID returns the key id of a request verified by the Middleware
+func KeyID(ctx context.Context) (string, bool) {
+	keyID, ok := ctx.Value(keyIDContext{}).(string)
+	return keyID, ok
+}
+
+// StringToSign returns the canonical string of a request
+func StringToSign(method, requestUri, keyID, timestamp, nonce, bodyHash string) string {
+	return fmt.Sprintf("%v\n%v\n%v\n%v\n%v\n%v", method, requestUri, keyID, timestamp, nonce, bodyHash)
+}
+
+// Signature computes the base64 encoded HMAC-SHA256 of the message
+func Signature(secret []byte, message string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(message))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// BodyHash returns the hex encoded SHA-256 of the body
+func BodyHash(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// Sign adds the signature headers for the body to the request, the key id
+// names the secret for the server
+func Sign(req *http.Request, keyID string, secret []byte, body []byte) error {
+	raw := make([]byte, nonceSize)
+	if _, err := rand.Read(raw); err != nil {
+		return err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	nonce := hex.EncodeToString(raw)
+	bodyHash := BodyHash(body)
+	message := StringToSign(req.Method, req.URL.RequestURI(), keyID, timestamp, nonce, bodyHash)
+	req.Header.Set(HeaderKeyID, keyID)
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderNonce, nonce)
+	req.Header.Set(HeaderBodyHash, bodyHash)
+	req.Header.Set(HeaderSignature, Signature(secret, message))
+	return nil
+}
+
+// Verifier checks signed requests. Secret returns the shared secret of
+// the key id, i.e. the publisher, of the request.
+type Verifier struct {
+	Secret  func(keyID string) ([]byte, bool)
+	MaxSkew time.Duration
+	Now     func() time.Time
+
+	mu     sync.Mutex
+	nonces map[string]bool
+	expiry nonceHeap
+}
+
+// NewVerifier returns a Verifier with the default skew
+func NewVerifier(secret func(keyID string) ([]byte, bool)) *Verifier {
+	return &Verifier{Secret: secret, MaxSkew: DefaultMaxSkew, Now: time.Now}
+}
+
+// Verify checks the signature of the request. The body is read and
+// replaced, so handlers can read it again.
+func (v *Verifier) Verify(req *http.Request) error {
+	keyID := req.Header.Get(HeaderKeyID)
+	timestamp := req.Header.Get(HeaderTimestamp)
+	nonce := req.Header.Get(HeaderNonce)
+	bodyHash := req.Header.Get(HeaderBodyHash)
+	signature := req.Header.Get(HeaderSignature)
+	if keyID == "" || timestamp == "" || nonce == "" || bodyHash == "" || signature == "" {
+		return ErrMissingHeader
+	}
+	// A publisher in Authorization has to be the signer, token owners are
+	// checked by the handler with KeyID
+	auth := req.Header.Get("Authorization")
+	if auth != "" && !strings.HasPrefix(auth, "Bearer ") && auth != keyID {
+		return ErrKeyMismatch
+	}
+	secret, ok := v.Secret(keyID)
+	if !ok {
+		return ErrUnknownSecret
+	}
+
+	// Check the time window
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrExpired
+	}
+	now := v.now()
+	sent := time.Unix(unix, 0)
+	if sent.Before(now.Add(-v.maxSkew())) || sent.After(now.Add(v.maxSkew())) {
+		return ErrExpired
+	}
+
+	// Check body and signature
+	var body []byte
+	if req.Body != nil {
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return err
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	if !hmac.Equal([]byte(BodyHash(body)), []byte(bodyHash)) {
+		return ErrBodyHash
+	}
+	message := StringToSign(req.Method, req.URL.RequestURI(), keyID, timestamp, nonce, bodyHash)
+	if !hmac.Equal([]byte(Signature(secret, message)), []byte(signature)) {
+		return ErrSignature
+	}
+
+	// Only remember nonces of valid requests
+	return v.useNonce(nonce, sent, now)
+}
+
+// Middleware rejects requests that fail the verification with 401 and
+// passes the verified key id in the request context, see KeyID
+func (v *Verifier) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if err := v.Verify(req); err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		ctx := context.WithValue(req.Context(), keyIDContext{}, req.Header.Get(HeaderKeyID))
+		next.ServeHTTP(w, req.WithContext(ctx))
+	})
+}
+
+// useNonce records the nonce, it fails for nonces seen before. Nonces are
+// forgotten once their request is outside of the skew, so the cache holds
+// at most the nonces of one skew window. If that exceeds the limit the
+// request is rejected, forgetting nonces early would allow replays.
+func (v *Verifier) useNonce(nonce string, sent, now time.Time) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.nonces == nil {
+		v.nonces = map[string]bool{}
+	}
+	for len(v.expiry) > 0 && v.expiry[0].expires.Before(now) {
+		delete(v.nonces, heap.Pop(&v.expiry).(nonceEntry).nonce)
+	}
+	if v.nonces[nonce] {
+		return ErrReplay
+	}
+	if len(v.nonces) >= maxNonceCacheLen {
+		return ErrNonceCache
+	}
+	v.nonces[nonce] = true
+	heap.Push(&v.expiry, nonceEntry{nonce: nonce, expires: sent.Add(v.maxSkew())})
+	return nil
+}
+
+// nonceEntry is a nonce with the time its request leaves the skew
+type nonceEntry struct {
+	nonce   string
+	expires time.Time
+}
+
+// nonceHeap orders nonces by expiry, the next to expire first
+type nonceHeap []nonceEntry
+
+func (h nonceHeap) Len() int            { return len(h) }
+func (h nonceHeap) Less(i, j int) bool  { return h[i].expires.Before(h[j].expires) }
+func (h nonceHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *nonceHeap) Push(x interface{}) { *h = append(*h, x.(nonceEntry)) }
+func (h *nonceHeap) Pop() interface{} {
+	old := *h
+	entry := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return entry
+}
+
+func (v *Verifier) now() time.Time {
+	if v.Now == nil {
+		return time.Now()
+	}
+	return v.Now()
+}
+
+func (v *Verifier) maxSkew() time.Duration {
+	if v.MaxSkew <= 0 {
+		return DefaultMaxSkew
+	}
+	return v.MaxSkew
+}
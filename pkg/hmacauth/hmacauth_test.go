@@ -0,0 +1,145 @@
+package hmacauth
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+var secrets = map[string][]byte{"alice": []byte("alice-secret"), "bob": []byte("bob-secret")}
+
+func testVerifier(now time.Time) *Verifier {
+	v := NewVerifier(func(keyID string) ([]byte, bool) {
+		secret, ok := secrets[keyID]
+		return secret, ok
+	})
+	v.Now = func() time.Time { return now }
+	return v
+}
+
+// signedRequest returns a request signed by alice with her publisher as
+// Authorization
+func signedRequest(t *testing.T, body string) *http.Request {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "http://hashref.example/api/hash/abc?x=1", bytes.NewBufferString(body))
+	req.Header.Set("Authorization", "alice")
+	if err := Sign(req, "alice", secrets["alice"], []byte(body)); err != nil {
+		t.Fatal(err)
+	}
+	return req
+}
+
+func TestVerify(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(req *http.Request)
+		skew   time.Duration
+		want   error
+	}{
+		{"valid", func(req *http.Request) {}, 0, nil},
+		{"valid with token", func(req *http.Request) { req.Header.Set("Authorization", "Bearer token") }, 0, nil},
+		{"valid within skew", func(req *http.Request) {}, DefaultMaxSkew - time.Second, nil},
+		{"tampered body", func(req *http.Request) { req.Body = io.NopCloser(bytes.NewBufferString(`{"a":2}`)) }, 0, ErrBodyHash},
+		{"tampered body hash", func(req *http.Request) {
+			req.Body = io.NopCloser(bytes.NewBufferString(`{"a":2}`))
+			req.Header.Set(HeaderBodyHash, BodyHash([]byte(`{"a":2}`)))
+		}, 0, ErrSignature},
+		{"tampered uri", func(req *http.Request) { req.URL.RawQuery = "x=2" }, 0, ErrSignature},
+		{"tampered method", func(req *http.Request) { req.Method = http.MethodDelete }, 0, ErrSignature},
+		{"tampered nonce", func(req *http.Request) { req.Header.Set(HeaderNonce, "other") }, 0, ErrSignature},
+		{"other key id", func(req *http.Request) {
+			req.Header.Set(HeaderKeyID, "bob")
+			req.Header.Set("Authorization", "bob")
+		}, 0, ErrSignature},
+		{"unknown key id", func(req *http.Request) {
+			req.Header.Set(HeaderKeyID, "eve")
+			req.Header.Set("Authorization", "eve")
+		}, 0, ErrUnknownSecret},
+		{"key id and publisher mismatch", func(req *http.Request) { req.Header.Set("Authorization", "bob") }, 0, ErrKeyMismatch},
+		{"missing key id", func(req *http.Request) { req.Header.Del(HeaderKeyID) }, 0, ErrMissingHeader},
+		{"missing signature", func(req *http.Request) { req.Header.Del(HeaderSignature) }, 0, ErrMissingHeader},
+		{"too old", func(req *http.Request) {}, DefaultMaxSkew + time.Second, ErrExpired},
+		{"from the future", func(req *http.Request) {}, -DefaultMaxSkew - time.Second, ErrExpired},
+		{"invalid timestamp", func(req *http.Request) { req.Header.Set(HeaderTimestamp, "soon") }, 0, ErrExpired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := signedRequest(t, `{"a":1}`)
+			tt.tamper(req)
+			err := testVerifier(time.Now().Add(tt.skew)).Verify(req)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("Verify() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyKeepsBody(t *testing.T) {
+	req := signedRequest(t, `{"a":1}`)
+	if err := testVerifier(time.Now()).Verify(req); err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(req.Body)
+	if string(body) != `{"a":1}` {
+		t.Errorf("body after Verify = %q", body)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	v := testVerifier(time.Now())
+	req := signedRequest(t, `{"a":1}`)
+	replay := req.Clone(req.Context())
+	replay.Body = io.NopCloser(bytes.NewBufferString(`{"a":1}`))
+	if err := v.Verify(req); err != nil {
+		t.Fatalf("first request: %v", err)
+	}
+	if err := v.Verify(replay); !errors.Is(err, ErrReplay) {
+		t.Errorf("replayed request: %v, want %v", err, ErrReplay)
+	}
+}
+
+func TestNonceExpiry(t *testing.T) {
+	now := time.Now()
+	v := testVerifier(now)
+	if err := v.useNonce("n1", now, now); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.useNonce("n1", now, now); !errors.Is(err, ErrReplay) {
+		t.Errorf("nonce within skew: %v, want %v", err, ErrReplay)
+	}
+
+	// Outside of the skew the nonce is forgotten, the timestamp check
+	// rejects such requests
+	later := now.Add(DefaultMaxSkew + time.Second)
+	if err := v.useNonce("n2", later, later); err != nil {
+		t.Fatal(err)
+	}
+	if len(v.nonces) != 1 || len(v.expiry) != 1 || !v.nonces["n2"] {
+		t.Errorf("nonces after expiry = %v", v.nonces)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	var keyID string
+	handler := testVerifier(time.Now()).Middleware(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		keyID, _ = KeyID(req.Context())
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, signedRequest(t, `{"a":1}`))
+	if rec.Code != http.StatusOK || keyID != "alice" {
+		t.Errorf("valid request: code %v, key id %q", rec.Code, keyID)
+	}
+
+	req := signedRequest(t, `{"a":1}`)
+	req.Header.Set("Authorization", "bob")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("mismatching publisher: code %v, want %v", rec.Code, http.StatusUnauthorized)
+	}
+}
@@ -0,0 +1,379 @@
+// Package magic detects the content type of files by magic bytes and
+// reports statistics of their content: entropy, text encoding and line
+// endings.
+package magic
+
+import (
+	"archive/zip"
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// sniffLen is the number of bytes inspected for magic bytes, enough for
+// the tar header at offset 257
+const sniffLen = 8192
+
+// signature is a magic byte sequence at an offset, short sequences have
+// an additional check of the header
+type signature struct {
+	offset int
+	magic  string
+	mime   string
+	check  func(head []byte) bool
+}
+
+// signatures are checked in order, the first match wins
+var signatures = []signature{
+	// Archives and compression
+	{0, "PK\x03\x04", "application/zip", nil},
+	{0, "PK\x05\x06", "application/zip", nil},
+	{0, "\x1f\x8b", "application/gzip", nil},
+	{0, "BZh", "application/x-bzip2", nil},
+	{0, "\xfd7zXZ\x00", "application/x-xz", nil},
+	{0, "\x28\xb5\x2f\xfd", "application/zstd", nil},
+	{0, "\x04\x22\x4d\x18", "application/x-lz4", nil},
+	{0, "7z\xbc\xaf\x27\x1c", "application/x-7z-compressed", nil},
+	{0, "Rar!\x1a\x07", "application/vnd.rar", nil},
+	{0, "MSCF", "application/vnd.ms-cab-compressed", nil},
+	{0, "\xed\xab\xee\xdb", "application/x-rpm", nil},
+	{0, "!<arch>\ndebian-binary", "application/vnd.debian.binary-package", nil},
+	{0, "!<arch>\n", "application/x-archive", nil},
+	{257, "ustar", "application/x-tar", nil},
+
+	// Executables
+	{0, "\x7fELF", "application/x-executable", nil},
+	{0, "MZ", "application/vnd.microsoft.portable-executable", isDOSHeader},
+	{0, "\xfe\xed\xfa\xce", "application/x-mach-binary", nil},
+	{0, "\xfe\xed\xfa\xcf", "application/x-mach-binary", nil},
+	{0, "\xce\xfa\xed\xfe", "application/x-mach-binary", nil},
+	{0, "\xcf\xfa\xed\xfe", "application/x-mach-binary", nil},
+	{0, "\x00asm", "application/wasm", nil},
+	{0, "dex\n", "application/vnd.android.dex", nil},
+
+	// Documents
+	{0, "%PDF-", "application/pdf", nil},
+	{0, "\xd0\xcf\x11\xe0\xa1\xb1\x1a\xe1", "application/x-ole-storage", nil},
+	{0, "{\\rtf", "application/rtf", nil},
+	{0, "SQLite format 3\x00", "application/vnd.sqlite3", nil},
+
+	// Images
+	{0, "\x89PNG\r\n\x1a\n", "image/png", nil},
+	{0, "\xff\xd8\xff", "image/jpeg", nil},
+	{0, "GIF87a", "image/gif", nil},
+	{0, "GIF89a", "image/gif", nil},
+	{0, "BM", "image/bmp", isBMPHeader},
+	{0, "II*\x00", "image/tiff", nil},
+	{0, "MM\x00*", "image/tiff", nil},
+	{0, "\x00\x00\x01\x00", "image/vnd.microsoft.icon", nil},
+	{0, "8BPS", "image/vnd.adobe.photoshop", nil},
+	{0, "\xff\x0a", "image/jxl", nil},
+
+	// Audio and video
+	{0, "ID3", "audio/mpeg", func(head []byte) bool { return len(head) > 3 && head[3] < 0x10 }},
+	{0, "OggS", "audio/ogg", nil},
+	{0, "fLaC", "audio/flac", nil},
+	{0, "\x1a\x45\xdf\xa3", "video/x-matroska", nil},
+
+	// Fonts
+	{0, "wOFF", "font/woff", nil},
+	{0, "wOF2", "font/woff2", nil},
+	{0, "OTTO", "font/otf", nil},
+	{0, "\x00\x01\x00\x00\x00", "font/ttf", nil},
+}
+
+// riffTypes maps the form type of RIFF containers
+var riffTypes = map[string]string{
+	"WEBP": "image/webp",
+	"WAVE": "audio/wav",
+	"AVI ": "video/x-msvideo",
+}
+
+// ftypBrands maps major brands of ISO base media files
+var ftypBrands = map[string]string{
+	"avif": "image/avif",
+	"avis": "image/avif",
+	"heic": "image/heic",
+	"heix": "image/heic",
+	"mif1": "image/heif",
+	"qt  ": "video/quicktime",
+	"M4A ": "audio/mp4",
+	"3gp4": "video/3gpp",
+	"3gp5": "video/3gpp",
+}
+
+// zipTypes maps an entry characteristic for a format to its type
+var zipTypes = []struct {
+	entry string
+	mime  string
+}{
+	{"word/document.xml", "application/vnd.openxmlformats-officedocument.wordprocessingml.document"},
+	{"xl/workbook.xml", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"},
+	{"ppt/presentation.xml", "application/vnd.openxmlformats-officedocument.presentationml.presentation"},
+	{"AndroidManifest.xml", "application/vnd.android.package-archive"},
+	{"META-INF/MANIFEST.MF", "application/java-archive"},
+}
+
+// oleTypes maps extensions of OLE2 compound files
+var oleTypes = map[string]string{
+	".doc": "application/msword",
+	".xls": "application/vnd.ms-excel",
+	".ppt": "application/vnd.ms-powerpoint",
+	".msi": "application/x-msi",
+	".msg": "application/vnd.ms-outlook",
+}
+
+// interpreters maps shebang interpreters to script types
+var interpreters = map[string]string{
+	"sh":      "text/x-shellscript",
+	"bash":    "text/x-shellscript",
+	"dash":    "text/x-shellscript",
+	"zsh":     "text/x-shellscript",
+	"ksh":     "text/x-shellscript",
+	"fish":    "text/x-shellscript",
+	"python":  "text/x-python",
+	"perl":    "text/x-perl",
+	"ruby":    "text/x-ruby",
+	"node":    "text/javascript",
+	"deno":    "text/javascript",
+	"php":     "application/x-httpd-php",
+	"lua":     "text/x-lua",
+	"tclsh":   "text/x-tcl",
+	"awk":     "text/x-awk",
+	"pwsh":    "text/x-powershell",
+	"Rscript": "text/x-r",
+}
+
+// Info describes the content of a file
+type Info struct {
+	MIME        string  // detected content type
+	Interpreter string  // interpreter of the shebang line of scripts
+	Entropy     float64 // Shannon entropy in bits per byte (0-8)
+	Size        int64   // size in bytes
+	Text        *TextInfo
+}
+
+// Detect reads the file and returns the content type and statistics
+func Detect(path string) (*Info, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, err
+	}
+	head = head[:n]
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	stats, err := analyze(f)
+	if err != nil {
+		return nil, err
+	}
+	info := &Info{Entropy: stats.entropy(), Size: stats.size, Text: stats.text()}
+	info.MIME, info.Interpreter = detectType(path, head, info.Text != nil)
+	if !IsTextType(info.MIME) {
+		info.Text = nil
+	}
+	return info, nil
+}
+
+// detectType returns the content type and the interpreter of scripts, the
+// path is used to refine container formats
+func detectType(path string, head []byte, isText bool) (string, string) {
+	if len(head) == 0 {
+		return "inode/x-empty", ""
+	}
+	if bytes.HasPrefix(head, []byte("#!")) {
+		interpreter := shebangInterpreter(head)
+		base := strings.TrimRight(interpreter, "0123456789.")
+		if mime, ok := interpreters[base]; ok {
+			return mime, interpreter
+		}
+		return "text/x-script", interpreter
+	}
+	for _, s := range signatures {
+		if len(head) >= s.offset+len(s.magic) && string(head[s.offset:s.offset+len(s.magic)]) == s.magic && (s.check == nil || s.check(head)) {
+			return refine(path, head, s.mime), ""
+		}
+	}
+	if len(head) >= 12 && string(head[:4]) == "RIFF" {
+		if mime, ok := riffTypes[string(head[8:12])]; ok {
+			return mime, ""
+		}
+	}
+	if len(head) >= 12 && string(head[4:8]) == "ftyp" {
+		if mime, ok := ftypBrands[string(head[8:12])]; ok {
+			return mime, ""
+		}
+		return "video/mp4", ""
+	}
+	if len(head) >= 8 && string(head[:4]) == "\xca\xfe\xba\xbe" {
+		// Universal Mach-O binaries have few architectures, Java class
+		// files store their version at the same position
+		if binary.BigEndian.Uint32(head[4:]) < 45 {
+			return "application/x-mach-binary", ""
+		}
+		return "application/java-vm", ""
+	}
+	mime := http.DetectContentType(head)
+	if i := strings.Index(mime, ";"); i > 0 {
+		mime = mime[:i]
+	}
+	switch {
+	case (mime == "text/xml" || mime == "text/plain") && bytes.Contains(head, []byte("<svg")):
+		return "image/svg+xml", ""
+	case mime == "text/plain" && isJSON(head):
+		return "application/json", ""
+	case isText && !IsTextType(mime):
+		// The sniffer matches short prefixes, e.g. BM for bitmaps
+		return "text/plain", ""
+	}
+	return mime, ""
+}
+
+// textTypes are content types besides text/* that are text
+var textTypes = map[string]bool{
+	"application/json":        true,
+	"application/xml":         true,
+	"application/javascript":  true,
+	"application/postscript":  true,
+	"application/rtf":         true,
+	"application/x-httpd-php": true,
+	"image/svg+xml":           true,
+}
+
+// IsTextType reports if content of the type is text
+func IsTextType(mime string) bool {
+	return strings.HasPrefix(mime, "text/") || textTypes[mime]
+}
+
+// refine specialises container formats
+func refine(path string, head []byte, mime string) string {
+	switch mime {
+	case "application/zip":
+		return zipType(path, head)
+	case "application/x-ole-storage":
+		if t, ok := oleTypes[strings.ToLower(filepath.Ext(path))]; ok {
+			return t
+		}
+	case "application/x-executable":
+		return elfType(path)
+	}
+	return mime
+}
+
+// zipType detects office documents, java and android archives
+func zipType(path string, head []byte) string {
+	// OpenDocument stores its type uncompressed as first entry
+	if len(head) > 38 && string(head[30:38]) == "mimetype" && binary.LittleEndian.Uint16(head[8:]) == 0 {
+		size := int(binary.LittleEndian.Uint32(head[18:]))
+		start := 30 + int(binary.LittleEndian.Uint16(head[26:])) + int(binary.LittleEndian.Uint16(head[28:]))
+		if size > 0 && size < 128 && start+size <= len(head) {
+			return string(head[start : start+size])
+		}
+	}
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		return "application/zip"
+	}
+	defer r.Close()
+	names := map[string]bool{}
+	for _, f := range r.File {
+		names[f.Name] = true
+	}
+	for _, t := range zipTypes {
+		if names[t.entry] {
+			return t.mime
+		}
+	}
+	return "application/zip"
+}
+
+// elfType distinguishes executables, shared libraries, objects and core
+// dumps
+func elfType(path string) string {
+	f, err := elf.Open(path)
+	if err != nil {
+		return "application/x-executable"
+	}
+	defer f.Close()
+	switch f.Type {
+	case elf.ET_REL:
+		return "application/x-object"
+	case elf.ET_CORE:
+		return "application/x-coredump"
+	case elf.ET_DYN:
+		// Position independent executables have an interpreter
+		for _, p := range f.Progs {
+			if p.Type == elf.PT_INTERP {
+				return "application/x-executable"
+			}
+		}
+		return "application/x-sharedlib"
+	}
+	return "application/x-executable"
+}
+
+// isDOSHeader checks the size of a DOS executable header
+func isDOSHeader(head []byte) bool {
+	return len(head) >= 64
+}
+
+// isBMPHeader checks the size of the DIB header of a bitmap
+func isBMPHeader(head []byte) bool {
+	if len(head) < 18 {
+		return false
+	}
+	switch binary.LittleEndian.Uint32(head[14:]) {
+	case 12, 40, 52, 56, 64, 108, 124:
+		return true
+	}
+	return false
+}
+
+// shebangInterpreter returns the interpreter of a shebang line, for env
+// the program started by env
+func shebangInterpreter(head []byte) string {
+	line := head[2:]
+	if i := bytes.IndexByte(line, '\n'); i >= 0 {
+		line = line[:i]
+	}
+	fields := strings.Fields(strings.TrimSpace(string(line)))
+	if len(fields) == 0 {
+		return ""
+	}
+	interpreter := filepath.Base(fields[0])
+	if interpreter == "env" {
+		for _, arg := range fields[1:] {
+			if !strings.HasPrefix(arg, "-") && !strings.Contains(arg, "=") {
+				return filepath.Base(arg)
+			}
+		}
+	}
+	return interpreter
+}
+
+// isJSON reports if the text starts like a JSON object or array
+func isJSON(head []byte) bool {
+	trimmed := bytes.TrimLeft(bytes.TrimPrefix(head, []byte("\xef\xbb\xbf")), " \t\r\n")
+	if len(trimmed) < 2 || (trimmed[0] != '{' && trimmed[0] != '[') {
+		return false
+	}
+	next := bytes.TrimLeft(trimmed[1:], " \t\r\n")
+	if len(next) == 0 {
+		return false
+	}
+	if trimmed[0] == '{' {
+		return next[0] == '"' || next[0] == '}'
+	}
+	return strings.IndexByte(`"{[]-0123456789tfn`, next[0]) >= 0
+}
@@ -0,0 +1,234 @@
+package magic
+
+import (
+	"archive/zip"
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// padded returns the magic at offset in a zero filled header
+func padded(offset int, magic string) []byte {
+	head := make([]byte, 512)
+	copy(head[offset:], magic)
+	return head
+}
+
+func TestSignatures(t *testing.T) {
+	for _, s := range signatures {
+		head := padded(s.offset, s.magic)
+		if s.mime == "image/bmp" {
+			binary.LittleEndian.PutUint32(head[14:], 40)
+		}
+		if mime, _ := detectType("file.bin", head, false); mime != s.mime {
+			t.Errorf("detectType(%q at %v) = %v, want %v", s.magic, s.offset, mime, s.mime)
+		}
+	}
+}
+
+func TestDetectType(t *testing.T) {
+	bmp := []byte("BM\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x28\x00\x00\x00")
+	tests := []struct {
+		name        string
+		head        []byte
+		isText      bool
+		mime        string
+		interpreter string
+	}{
+		{"empty", nil, false, "inode/x-empty", ""},
+
+		// Short signatures with additional checks
+		{"bitmap", bmp, false, "image/bmp", ""},
+		{"BM text", []byte("BM is not a bitmap"), true, "text/plain", ""},
+		{"MZ text", []byte("MZ hello"), true, "text/plain", ""},
+		{"ID3 v2", []byte("ID3\x04\x00"), false, "audio/mpeg", ""},
+		{"ID3 text", []byte("ID3 tags"), true, "text/plain", ""},
+
+		// RIFF containers
+		{"webp", []byte("RIFF\x24\x00\x00\x00WEBPVP8 "), false, "image/webp", ""},
+		{"wav", []byte("RIFF\x24\x00\x00\x00WAVEfmt "), false, "audio/wav", ""},
+		{"avi", []byte("RIFF\x24\x00\x00\x00AVI LIST"), false, "video/x-msvideo", ""},
+
+		// ISO base media files
+		{"mp4", []byte("\x00\x00\x00\x18ftypisom\x00\x00\x02\x00"), false, "video/mp4", ""},
+		{"heic", []byte("\x00\x00\x00\x18ftypheic\x00\x00\x00\x00"), false, "image/heic", ""},
+		{"avif", []byte("\x00\x00\x00\x1cftypavif\x00\x00\x00\x00"), false, "image/avif", ""},
+		{"quicktime", []byte("\x00\x00\x00\x14ftypqt  \x00\x00\x02\x00"), false, "video/quicktime", ""},
+		{"m4a", []byte("\x00\x00\x00\x20ftypM4A \x00\x00\x00\x00"), false, "audio/mp4", ""},
+
+		// Universal binaries and Java classes share their magic
+		{"universal binary", []byte("\xca\xfe\xba\xbe\x00\x00\x00\x02\x01\x00\x00\x07"), false, "application/x-mach-binary", ""},
+		{"java class", []byte("\xca\xfe\xba\xbe\x00\x00\x00\x34\x00\x0a"), false, "application/java-vm", ""},
+		{"old java class", []byte("\xca\xfe\xba\xbe\x00\x03\x00\x2d\x00\x0a"), false, "application/java-vm", ""},
+
+		// Scripts
+		{"sh", []byte("#!/bin/sh\necho hi\n"), true, "text/x-shellscript", "sh"},
+		{"bash with space", []byte("#! /bin/bash -e\n"), true, "text/x-shellscript", "bash"},
+		{"env python", []byte("#!/usr/bin/env python3\nprint()\n"), true, "text/x-python", "python3"},
+		{"versioned python", []byte("#!/usr/bin/python3.11\n"), true, "text/x-python", "python3.11"},
+		{"env with flags", []byte("#!/usr/bin/env -S node --no-warnings\n"), true, "text/javascript", "node"},
+		{"env with variables", []byte("#!/usr/bin/env RUBYOPT=-w ruby\n"), true, "text/x-ruby", "ruby"},
+		{"perl with flags", []byte("#!/usr/bin/perl -w\n"), true, "text/x-perl", "perl"},
+		{"Rscript", []byte("#!/usr/bin/env Rscript\n"), true, "text/x-r", "Rscript"},
+		{"php", []byte("#!/usr/bin/php\n<?php\n"), true, "application/x-httpd-php", "php"},
+		{"unknown interpreter", []byte("#!/opt/tool/run\n"), true, "text/x-script", "run"},
+		{"bare shebang", []byte("#!\n"), true, "text/x-script", ""},
+
+		// SVG
+		{"svg", []byte(`<svg xmlns="http://www.w3.org/2000/svg"></svg>`), true, "image/svg+xml", ""},
+		{"svg with xml declaration", []byte("<?xml version=\"1.0\"?>\n<svg></svg>"), true, "image/svg+xml", ""},
+		{"xml", []byte("<?xml version=\"1.0\"?>\n<root/>"), true, "text/xml", ""},
+		{"html with svg", []byte("<!DOCTYPE html><html><svg></svg></html>"), true, "text/html", ""},
+
+		// JSON
+		{"json object", []byte(`{"a": 1}`), true, "application/json", ""},
+		{"json array", []byte("[\n  1, 2]"), true, "application/json", ""},
+		{"empty json array", []byte("[]"), true, "application/json", ""},
+		{"json with bom", []byte("\xef\xbb\xbf  {\"a\": true}"), true, "application/json", ""},
+		{"empty json object", []byte("{ }"), true, "application/json", ""},
+		{"braces", []byte("{ not json"), true, "text/plain", ""},
+		{"template", []byte("{{ .Name }}"), true, "text/plain", ""},
+		{"unbalanced array", []byte("[}"), true, "text/plain", ""},
+		{"ini section", []byte("[section]\nkey=value\n"), true, "text/plain", ""},
+		{"text", []byte("hello world\n"), true, "text/plain", ""},
+	}
+	for _, tt := range tests {
+		mime, interpreter := detectType("file", tt.head, tt.isText)
+		if mime != tt.mime || interpreter != tt.interpreter {
+			t.Errorf("%v: detectType() = %v %q, want %v %q", tt.name, mime, interpreter, tt.mime, tt.interpreter)
+		}
+	}
+}
+
+// writeZip creates a zip with the entries, the first one stored
+// uncompressed with its size in the local header like OpenDocument
+func writeZip(t *testing.T, path string, entries map[string]string, first string) {
+	t.Helper()
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	if first != "" {
+		content := []byte(entries[first])
+		fw, err := w.CreateRaw(&zip.FileHeader{
+			Name:               first,
+			Method:             zip.Store,
+			CRC32:              crc32.ChecksumIEEE(content),
+			CompressedSize64:   uint64(len(content)),
+			UncompressedSize64: uint64(len(content)),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write(content)
+	}
+	for name, content := range entries {
+		if name == first {
+			continue
+		}
+		fw, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write([]byte(content))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestZipType(t *testing.T) {
+	const odt = "application/vnd.oasis.opendocument.text"
+	tests := []struct {
+		name    string
+		entries map[string]string
+		first   string
+		mime    string
+	}{
+		{"zip", map[string]string{"a.txt": "a"}, "", "application/zip"},
+		{"docx", map[string]string{"[Content_Types].xml": "", "word/document.xml": ""}, "", "application/vnd.openxmlformats-officedocument.wordprocessingml.document"},
+		{"xlsx", map[string]string{"xl/workbook.xml": ""}, "", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"},
+		{"pptx", map[string]string{"ppt/presentation.xml": ""}, "", "application/vnd.openxmlformats-officedocument.presentationml.presentation"},
+		{"apk", map[string]string{"AndroidManifest.xml": "", "META-INF/MANIFEST.MF": ""}, "", "application/vnd.android.package-archive"},
+		{"jar", map[string]string{"META-INF/MANIFEST.MF": "Manifest-Version: 1.0\n", "A.class": ""}, "", "application/java-archive"},
+		{"odt", map[string]string{"mimetype": odt, "content.xml": ""}, "mimetype", odt},
+		{"compressed mimetype", map[string]string{"mimetype": odt}, "", "application/zip"},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "archive")
+		writeZip(t, path, tt.entries, tt.first)
+		info, err := Detect(path)
+		if err != nil {
+			t.Errorf("%v: %v", tt.name, err)
+			continue
+		}
+		if info.MIME != tt.mime {
+			t.Errorf("%v: Detect() = %v, want %v", tt.name, info.MIME, tt.mime)
+		}
+	}
+
+	// Only the local header is available for truncated archives
+	head := padded(0, "PK\x03\x04")
+	if mime, _ := detectType(filepath.Join(t.TempDir(), "missing.zip"), head, false); mime != "application/zip" {
+		t.Errorf("detectType() of unreadable zip = %v", mime)
+	}
+}
+
+func TestRefine(t *testing.T) {
+	ole := padded(0, "\xd0\xcf\x11\xe0\xa1\xb1\x1a\xe1")
+	elfFile := func(typ elf.Type, interp bool) []byte {
+		header := elf.Header64{Type: uint16(typ), Machine: uint16(elf.EM_X86_64), Version: uint32(elf.EV_CURRENT), Ehsize: 64, Phentsize: 56, Shentsize: 64}
+		copy(header.Ident[:], "\x7fELF")
+		header.Ident[elf.EI_CLASS] = byte(elf.ELFCLASS64)
+		header.Ident[elf.EI_DATA] = byte(elf.ELFDATA2LSB)
+		header.Ident[elf.EI_VERSION] = byte(elf.EV_CURRENT)
+		var buf bytes.Buffer
+		if interp {
+			header.Phoff, header.Phnum = 64, 1
+			binary.Write(&buf, binary.LittleEndian, header)
+			binary.Write(&buf, binary.LittleEndian, elf.Prog64{Type: uint32(elf.PT_INTERP), Off: 120, Filesz: 1})
+			buf.WriteByte(0)
+		} else {
+			binary.Write(&buf, binary.LittleEndian, header)
+		}
+		return buf.Bytes()
+	}
+	tests := []struct {
+		name    string
+		file    string
+		content []byte
+		mime    string
+	}{
+		{"doc", "report.doc", ole, "application/msword"},
+		{"xls", "sheet.XLS", ole, "application/vnd.ms-excel"},
+		{"ppt", "slides.ppt", ole, "application/vnd.ms-powerpoint"},
+		{"msi", "setup.msi", ole, "application/x-msi"},
+		{"msg", "mail.msg", ole, "application/vnd.ms-outlook"},
+		{"unknown ole", "file.bin", ole, "application/x-ole-storage"},
+		{"executable", "app", elfFile(elf.ET_EXEC, false), "application/x-executable"},
+		{"position independent executable", "app", elfFile(elf.ET_DYN, true), "application/x-executable"},
+		{"shared library", "lib.so", elfFile(elf.ET_DYN, false), "application/x-sharedlib"},
+		{"object", "main.o", elfFile(elf.ET_REL, false), "application/x-object"},
+		{"core dump", "core", elfFile(elf.ET_CORE, false), "application/x-coredump"},
+		{"invalid elf", "app", []byte("\x7fELF garbage"), "application/x-executable"},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), tt.file)
+		if err := os.WriteFile(path, tt.content, 0644); err != nil {
+			t.Fatal(err)
+		}
+		info, err := Detect(path)
+		if err != nil {
+			t.Errorf("%v: %v", tt.name, err)
+			continue
+		}
+		if info.MIME != tt.mime || info.Text != nil {
+			t.Errorf("%v: Detect() = %v text %v, want %v", tt.name, info.MIME, info.Text, tt.mime)
+		}
+	}
+}
@@ -0,0 +1,261 @@
+package magic
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"unicode/utf8"
+)
+
+// Encodings of text
+const (
+	EncodingASCII   = "ascii"
+	EncodingUTF8    = "utf-8"
+	EncodingUTF16LE = "utf-16le"
+	EncodingUTF16BE = "utf-16be"
+	EncodingLatin   = "8bit" // 8 bit text that is not valid UTF-8, e.g. latin-1
+)
+
+// Line endings of text
+const (
+	LineEndingLF    = "lf"
+	LineEndingCRLF  = "crlf"
+	LineEndingCR    = "cr"
+	LineEndingMixed = "mixed"
+	LineEndingNone  = "none"
+)
+
+// maxControlRatio is the share of control characters tolerated in text
+const maxControlRatio = 0.01
+
+// TextInfo describes text content
+type TextInfo struct {
+	Encoding   string // ascii, utf-8, utf-16le, utf-16be or 8bit
+	BOM        bool   // content starts with a byte order mark
+	LineEnding string // lf, crlf, cr, mixed or none
+	Lines      int64  // number of lines, a last line without line break included
+}
+
+// stats are collected in one pass over the content
+type stats struct {
+	size     int64
+	counts   [256]int64
+	bom      string
+	utf8     bool
+	ascii    bool
+	controls int64
+	units    int64 // characters for utf-16, bytes otherwise
+
+	lf, crlf, cr int64
+	pendingCR    bool
+	lastUnit     uint16
+}
+
+// analyze reads the content and collects byte frequencies and text
+// properties
+func analyze(r io.Reader) (*stats, error) {
+	s := &stats{utf8: true, ascii: true}
+	buf := make([]byte, 64*1024)
+	var carry []byte
+	first := true
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			chunk := append(carry, buf[:n]...)
+			if first {
+				first = false
+				chunk = s.readBOM(chunk)
+			}
+			carry = s.add(chunk)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(carry) > 0 {
+		// Truncated UTF-8 sequence or odd UTF-16 length
+		s.utf8 = false
+		if s.bom == EncodingUTF16LE || s.bom == EncodingUTF16BE {
+			s.controls++
+		}
+	}
+	if s.pendingCR {
+		s.cr++
+	}
+	return s, nil
+}
+
+// readBOM detects and skips a byte order mark
+func (s *stats) readBOM(chunk []byte) []byte {
+	boms := []struct {
+		mark     string
+		encoding string
+	}{
+		{"\xef\xbb\xbf", EncodingUTF8},
+		{"\xff\xfe", EncodingUTF16LE},
+		{"\xfe\xff", EncodingUTF16BE},
+	}
+	for _, b := range boms {
+		if bytes.HasPrefix(chunk, []byte(b.mark)) {
+			s.bom = b.encoding
+			for _, c := range []byte(b.mark) {
+				s.counts[c]++
+			}
+			s.size += int64(len(b.mark))
+			return chunk[len(b.mark):]
+		}
+	}
+	return chunk
+}
+
+// add counts a chunk and returns the bytes of an incomplete character
+func (s *stats) add(chunk []byte) []byte {
+	utf16 := s.bom == EncodingUTF16LE || s.bom == EncodingUTF16BE
+	complete := len(chunk)
+	switch {
+	case utf16:
+		complete -= len(chunk) % 2
+	case s.utf8:
+		// Keep an incomplete UTF-8 sequence for the next chunk
+		for i := len(chunk) - 1; i >= 0 && i >= len(chunk)-utf8.UTFMax; i-- {
+			if utf8.RuneStart(chunk[i]) {
+				if !utf8.FullRune(chunk[i:]) {
+					complete = i
+				}
+				break
+			}
+		}
+	}
+	data := chunk[:complete]
+	for _, c := range data {
+		s.counts[c]++
+	}
+	s.size += int64(len(data))
+	if s.utf8 && !utf8.Valid(data) {
+		s.utf8 = false
+	}
+
+	if utf16 {
+		for i := 0; i+1 < len(data); i += 2 {
+			unit := uint16(data[i]) | uint16(data[i+1])<<8
+			if s.bom == EncodingUTF16BE {
+				unit = uint16(data[i])<<8 | uint16(data[i+1])
+			}
+			s.addUnit(unit)
+		}
+	} else {
+		for _, c := range data {
+			if c >= 0x80 {
+				s.ascii = false
+			}
+			s.addUnit(uint16(c))
+		}
+	}
+	return append([]byte{}, chunk[complete:]...)
+}
+
+// addUnit counts line endings and control characters
+func (s *stats) addUnit(unit uint16) {
+	s.units++
+	if s.pendingCR {
+		s.pendingCR = false
+		if unit == '\n' {
+			s.crlf++
+			s.lastUnit = unit
+			return
+		}
+		s.cr++
+	}
+	switch {
+	case unit == '\r':
+		s.pendingCR = true
+	case unit == '\n':
+		s.lf++
+	case unit < 0x20 && unit != '\t' && unit != '\f' && unit != 0x1b, unit == 0x7f:
+		s.controls++
+	}
+	s.lastUnit = unit
+}
+
+// entropy returns the Shannon entropy in bits per byte
+func (s *stats) entropy() float64 {
+	if s.size == 0 {
+		return 0
+	}
+	e := 0.0
+	for _, c := range s.counts {
+		if c > 0 {
+			p := float64(c) / float64(s.size)
+			e -= p * math.Log2(p)
+		}
+	}
+	return math.Round(e*10000) / 10000
+}
+
+// text returns the text properties or nil for binary content
+func (s *stats) text() *TextInfo {
+	if s.size == 0 || float64(s.controls) > float64(s.units)*maxControlRatio {
+		return nil
+	}
+	t := &TextInfo{BOM: s.bom != ""}
+	switch {
+	case s.bom == EncodingUTF16LE || s.bom == EncodingUTF16BE:
+		t.Encoding = s.bom
+	case s.ascii && s.bom == "":
+		t.Encoding = EncodingASCII
+	case s.utf8:
+		t.Encoding = EncodingUTF8
+	case s.bom == "":
+		t.Encoding = EncodingLatin
+	default:
+		// Byte order mark of UTF-8 with invalid content
+		return nil
+	}
+
+	t.Lines = s.lf + s.crlf + s.cr
+	if s.lastUnit != '\n' && s.lastUnit != '\r' && s.units > 0 {
+		t.Lines++
+	}
+	kinds := 0
+	for _, c := range []int64{s.lf, s.crlf, s.cr} {
+		if c > 0 {
+			kinds++
+		}
+	}
+	switch {
+	case kinds == 0:
+		t.LineEnding = LineEndingNone
+	case kinds > 1:
+		t.LineEnding = LineEndingMixed
+	case s.crlf > 0:
+		t.LineEnding = LineEndingCRLF
+	case s.cr > 0:
+		t.LineEnding = LineEndingCR
+	default:
+		t.LineEnding = LineEndingLF
+	}
+	return t
+}
+
+// Metadata returns the information as metadata with content_ prefixed
+// keys, values keep their type
+func (info Info) Metadata() map[string]interface{} {
+	meta := map[string]interface{}{
+		"content_type":    info.MIME,
+		"content_entropy": info.Entropy,
+		"content_text":    info.Text != nil,
+	}
+	if info.Interpreter != "" {
+		meta["content_interpreter"] = info.Interpreter
+	}
+	if info.Text != nil {
+		meta["content_encoding"] = info.Text.Encoding
+		meta["content_bom"] = info.Text.BOM
+		meta["content_line_endings"] = info.Text.LineEnding
+		meta["content_lines"] = info.Text.Lines
+	}
+	return meta
+}
@@ -0,0 +1,73 @@
+package output
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/NodyHub/hashref/pkg/hashref"
+)
+
+// Formats lists the supported output formats
+var Formats = []string{"text", "json", "ndjson", "csv", "yaml", "table", "sha256sum", "bsd"}
+
+// Writer renders results in a specific output format. Close must be
+// called after the last result, formats that need to see all results
+// (e.g. json or table) only write on Close.
+type Writer interface {
+	Write(r hashref.Result) error
+	Close() error
+}
+
+// New returns a Writer for the requested format. The details flag is
+// only respected by the text format, all other formats always contain
+// the metadata.
+func New(format string, w io.Writer, details bool) (Writer, error) {
+	switch strings.ToLower(format) {
+	case "", "text":
+		return &textWriter{w: w, details: details}, nil
+	case "json":
+		return &jsonWriter{w: w}, nil
+	case "ndjson":
+		return &ndjsonWriter{w: w}, nil
+	case "csv":
+		return newCsvWriter(w), nil
+	case "yaml":
+		return &yamlWriter{w: w}, nil
+	case "table":
+		return newTableWriter(w), nil
+	case "sha256sum":
+		return &checksumWriter{w: w}, nil
+	case "bsd":
+		return &checksumWriter{w: w, bsd: true}, nil
+	}
+	return nil, fmt.Errorf("unknown output format %q, expected one of %v", format, strings.Join(Formats, ", "))
+}
+
+// transformWriter passes results through a function before handing
+// them to the wrapped writer
+type transformWriter struct {
+	w  Writer
+	fn func(r *hashref.Result) (bool, error)
+}
+
+// Transform returns a Writer that applies fn to every result before it
+// is written to w, results for which fn returns false are dropped
+func Transform(w Writer, fn func(r *hashref.Result) (bool, error)) Writer {
+	return &transformWriter{w: w, fn: fn}
+}
+
+func (t *transformWriter) Write(r hashref.Result) error {
+	keep, err := t.fn(&r)
+	if err != nil {
+		return err
+	}
+	if !keep {
+		return nil
+	}
+	return t.w.Write(r)
+}
+
+func (t *transformWriter) Close() error {
+	return t.w.Close()
+}
@@ -0,0 +1,145 @@
+package output
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/NodyHub/hashref/pkg/hashref"
+	"gopkg.in/yaml.v3"
+)
+
+// jsonWriter collects all results and prints them as one JSON array
+type jsonWriter struct {
+	w       io.Writer
+	results []hashref.Result
+}
+
+func (j *jsonWriter) Write(r hashref.Result) error {
+	j.results = append(j.results, r)
+	return nil
+}
+
+func (j *jsonWriter) Close() error {
+	if j.results == nil {
+		j.results = []hashref.Result{}
+	}
+	b, err := json.MarshalIndent(j.results, "", "    ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(j.w, "%s\n", b)
+	return err
+}
+
+// ndjsonWriter prints every result as a single JSON line
+type ndjsonWriter struct {
+	w io.Writer
+}
+
+func (n *ndjsonWriter) Write(r hashref.Result) error {
+	return json.NewEncoder(n.w).Encode(r)
+}
+
+func (n *ndjsonWriter) Close() error {
+	return nil
+}
+
+// yamlWriter collects all results and prints them as one YAML sequence
+type yamlWriter struct {
+	w       io.Writer
+	results []hashref.Result
+}
+
+func (y *yamlWriter) Write(r hashref.Result) error {
+	y.results = append(y.results, r)
+	return nil
+}
+
+func (y *yamlWriter) Close() error {
+	if y.results == nil {
+		y.results = []hashref.Result{}
+	}
+	enc := yaml.NewEncoder(y.w)
+	enc.SetIndent(2)
+	if err := enc.Encode(y.results); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// csvWriter prints a header and one record per result, the metadata
+// column contains the metadata as compact JSON
+type csvWriter struct {
+	w *csv.Writer
+}
+
+func newCsvWriter(w io.Writer) *csvWriter {
+	c := &csvWriter{w: csv.NewWriter(w)}
+	c.w.Write([]string{"input", "type", "hash", "status", "error", "metadata"})
+	return c
+}
+
+func (c *csvWriter) Write(r hashref.Result) error {
+	meta := ""
+	if len(r.Meta) > 0 {
+		b, err := json.Marshal(r.Meta)
+		if err != nil {
+			return err
+		}
+		meta = string(b)
+	}
+	return c.w.Write([]string{r.Input, r.Type, r.Hash, string(r.Status), r.Error, meta})
+}
+
+func (c *csvWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// tableWriter prints aligned columns without the metadata
+type tableWriter struct {
+	w *tabwriter.Writer
+}
+
+func newTableWriter(w io.Writer) *tableWriter {
+	t := &tableWriter{w: tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)}
+	fmt.Fprintln(t.w, "INPUT\tTYPE\tHASH\tSTATUS\tERROR")
+	return t
+}
+
+func (t *tableWriter) Write(r hashref.Result) error {
+	_, err := fmt.Fprintf(t.w, "%v\t%v\t%v\t%v\t%v\n", r.Input, r.Type, r.Hash, r.Status, r.Error)
+	return err
+}
+
+func (t *tableWriter) Close() error {
+	return t.w.Flush()
+}
+
+// checksumWriter prints sha256sum compatible lines in GNU or BSD format
+type checksumWriter struct {
+	w   io.Writer
+	bsd bool
+}
+
+func (c *checksumWriter) Write(r hashref.Result) error {
+	var err error
+	if c.bsd {
+		_, err = fmt.Fprintf(c.w, "SHA256 (%v) = %v\n", r.Input, r.Hash)
+	} else if strings.ContainsAny(r.Input, "\\\n") {
+		// GNU escapes file names with backslash or newline
+		name := strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(r.Input)
+		_, err = fmt.Fprintf(c.w, "\\%v  %v\n", r.Hash, name)
+	} else {
+		_, err = fmt.Fprintf(c.w, "%v  %v\n", r.Hash, r.Input)
+	}
+	return err
+}
+
+func (c *checksumWriter) Close() error {
+	return nil
+}
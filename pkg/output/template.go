@@ -0,0 +1,152 @@
+package output
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/NodyHub/hashref/pkg/hashref"
+)
+
+// timeLayouts are tried in order when a string should be parsed as time,
+// the first one is the format of time.Time.String() used for last_published
+var timeLayouts = []string{
+	"2006-01-02 15:04:05.999999999 -0700 MST",
+	time.RFC3339Nano,
+	time.RFC1123Z,
+	"2006-01-02",
+}
+
+// TemplateFuncs are the helper functions available in output templates
+var TemplateFuncs = template.FuncMap{
+	"json":       templateJson,
+	"default":    templateDefault,
+	"join":       templateJoin,
+	"now":        time.Now,
+	"formatTime": templateFormatTime,
+}
+
+// templateWriter renders every result with a text/template. If the
+// template defines "header" or "footer", they are rendered with the
+// list of all results before and after the results.
+type templateWriter struct {
+	w       io.Writer
+	tmpl    *template.Template
+	results []hashref.Result
+}
+
+// NewTemplate returns a Writer that renders each result with the
+// provided template text
+func NewTemplate(text string, w io.Writer) (Writer, error) {
+	tmpl, err := template.New("result").Funcs(TemplateFuncs).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	return &templateWriter{w: w, tmpl: tmpl}, nil
+}
+
+func (t *templateWriter) Write(r hashref.Result) error {
+	t.results = append(t.results, r)
+	return nil
+}
+
+func (t *templateWriter) Close() error {
+	if t.results == nil {
+		t.results = []hashref.Result{}
+	}
+	if err := t.execute("header", t.results); err != nil {
+		return err
+	}
+	for _, r := range t.results {
+		if err := t.execute("result", r); err != nil {
+			return err
+		}
+	}
+	return t.execute("footer", t.results)
+}
+
+// execute renders the named template, if defined, and terminates the
+// output with a newline
+func (t *templateWriter) execute(name string, data interface{}) error {
+	if t.tmpl.Lookup(name) == nil {
+		return nil
+	}
+	var buf bytes.Buffer
+	if err := t.tmpl.ExecuteTemplate(&buf, name, data); err != nil {
+		return err
+	}
+	if buf.Len() == 0 {
+		return nil
+	}
+	if !bytes.HasSuffix(buf.Bytes(), []byte("\n")) {
+		buf.WriteString("\n")
+	}
+	_, err := t.w.Write(buf.Bytes())
+	return err
+}
+
+// templateJson encodes the value as compact JSON
+func templateJson(v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+	return string(b), err
+}
+
+// templateDefault returns def if the value is missing or empty
+func templateDefault(def, v interface{}) interface{} {
+	if v == nil {
+		return def
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		if rv.Len() == 0 {
+			return def
+		}
+	}
+	return v
+}
+
+// templateJoin concatenates the elements of a list with the separator
+func templateJoin(sep string, v interface{}) string {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return fmt.Sprintf("%v", v)
+	}
+	parts := make([]string, rv.Len())
+	for i := range parts {
+		parts[i] = fmt.Sprintf("%v", rv.Index(i).Interface())
+	}
+	return strings.Join(parts, sep)
+}
+
+// templateFormatTime formats a time.Time, a unix timestamp or a string
+// in one of the known time layouts with the provided layout
+func templateFormatTime(layout string, v interface{}) (string, error) {
+	switch t := v.(type) {
+	case time.Time:
+		return t.Format(layout), nil
+	case float64:
+		return time.Unix(int64(t), 0).Format(layout), nil
+	case int64:
+		return time.Unix(t, 0).Format(layout), nil
+	case int:
+		return time.Unix(int64(t), 0).Format(layout), nil
+	case string:
+		// Strip monotonic clock reading of time.Time.String()
+		if i := strings.Index(t, " m="); i > 0 {
+			t = t[:i]
+		}
+		for _, l := range timeLayouts {
+			if parsed, err := time.Parse(l, t); err == nil {
+				return parsed.Format(layout), nil
+			}
+		}
+		return "", fmt.Errorf("cannot parse time %q", t)
+	}
+	return "", fmt.Errorf("cannot format %T as time", v)
+}
@@ -0,0 +1,104 @@
+package output
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/NodyHub/hashref/pkg/hashref"
+	"github.com/NodyHub/hashref/pkg/util"
+)
+
+// textWriter prints human readable status lines or, in details mode,
+// the pretty printed metadata of each result
+type textWriter struct {
+	w       io.Writer
+	details bool
+}
+
+func (t *textWriter) Write(r hashref.Result) error {
+
+	// Detailed output?
+	if t.details {
+		meta := r.Meta
+		if r.Meta == nil {
+			meta = map[string]interface{}{"input": r.Input, "status": r.Status}
+			if r.Error != "" {
+				meta["error"] = r.Error
+			}
+		}
+		if r.Aggregation != nil {
+			meta = copyMap(meta)
+			meta["aggregation"] = r.Aggregation
+		}
+		if len(r.Violations) > 0 {
+			meta = copyMap(meta)
+			meta["violations"] = r.Violations
+		}
+		pretty, err := util.GetPrettyJsonFromMap(meta)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(t.w, "%v\n", pretty)
+		return err
+	}
+
+	// Just print the state
+	var err error
+	switch r.Status {
+	case hashref.StatusFound:
+		_, err = fmt.Fprintf(t.w, "%v found :)\n", r.Input)
+	case hashref.StatusNotFound:
+		_, err = fmt.Fprintf(t.w, "%v not found :(\n", r.Input)
+	case hashref.StatusSet:
+		_, err = fmt.Fprintf(t.w, "%v metadata set :)\n", r.Input)
+	case hashref.StatusNotSet:
+		_, err = fmt.Fprintf(t.w, "%v metadata not set :(\n", r.Input)
+	case hashref.StatusRemoved:
+		_, err = fmt.Fprintf(t.w, "%v removed :)\n", r.Input)
+	case hashref.StatusNotRemoved:
+		_, err = fmt.Fprintf(t.w, "%v not removed :(\n", r.Input)
+	case hashref.StatusUnchanged:
+		_, err = fmt.Fprintf(t.w, "%v unchanged :)\n", r.Input)
+	case hashref.StatusModified, hashref.StatusAdded, hashref.StatusMissing, hashref.StatusMismatch:
+		_, err = fmt.Fprintf(t.w, "%v %v :(\n", r.Input, r.Status)
+	default:
+		_, err = fmt.Fprintf(t.w, "%v %v: %v :(\n", r.Input, r.Status, r.Error)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Report disagreeing publishers
+	if r.Aggregation != nil {
+		for _, key := range r.Aggregation.Conflicts {
+			var claims []string
+			for _, vs := range r.Aggregation.Consensus[key].Values {
+				claims = append(claims, fmt.Sprintf("%v (%v)", vs.Value, strings.Join(vs.Publishers, ", ")))
+			}
+			if _, err := fmt.Fprintf(t.w, "%v conflict %v: %v\n", r.Input, key, strings.Join(claims, " vs ")); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Report matching policy rules
+	for _, v := range r.Violations {
+		if _, err := fmt.Fprintf(t.w, "%v violates %v (%v): %v\n", r.Input, v.Rule, v.Action, v.Message); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *textWriter) Close() error {
+	return nil
+}
+
+func copyMap(m map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
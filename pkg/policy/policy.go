@@ -0,0 +1,149 @@
+// Package policy evaluates rules against lookup results.
+//
+// A policy file is YAML or JSON with a list of rules. The condition of
+// a rule is a query (see package query) that is evaluated against an
+// object with the fields input, type, hash, status, error, metadata,
+// publishers (sorted names of the publishers that provided metadata) and
+// trusted (the subset of publishers that are configured as trusted) and
+// conflicts (metadata keys the publishers disagree on, with --aggregate).
+// A rule matches if any output of the condition is truthy.
+//
+//	rules:
+//	  - name: malicious
+//	    when: '.metadata.publishers[]?.verdict == "malicious"'
+//	    message: artifact is flagged as malicious
+//	  - name: unknown-file
+//	    when: '.type == "file" and (.trusted | length) == 0'
+//	    action: warn
+package policy
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/NodyHub/hashref/pkg/hashref"
+	"github.com/NodyHub/hashref/pkg/query"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	ActionFail = "fail"
+	ActionWarn = "warn"
+)
+
+// Rule is a single condition of a policy
+type Rule struct {
+	Name    string `json:"name" yaml:"name"`
+	When    string `json:"when" yaml:"when"`
+	Action  string `json:"action,omitempty" yaml:"action,omitempty"`
+	Message string `json:"message,omitempty" yaml:"message,omitempty"`
+
+	query *query.Query
+}
+
+// Policy is a list of rules that are evaluated in order
+type Policy struct {
+	Rules []*Rule `json:"rules" yaml:"rules"`
+}
+
+// Load reads and compiles a policy file in YAML or JSON format
+func Load(path string) (*Policy, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	p := &Policy{}
+	if err := yaml.Unmarshal(raw, p); err != nil {
+		return nil, fmt.Errorf("could not parse policy %v: %v", path, err)
+	}
+	if err := p.Compile(); err != nil {
+		return nil, fmt.Errorf("invalid policy %v: %v", path, err)
+	}
+	return p, nil
+}
+
+// Compile validates the rules and parses their conditions
+func (p *Policy) Compile() error {
+	for i, rule := range p.Rules {
+		if rule.Name == "" {
+			rule.Name = fmt.Sprintf("rule-%v", i+1)
+		}
+		switch rule.Action {
+		case "":
+			rule.Action = ActionFail
+		case ActionFail, ActionWarn:
+		default:
+			return fmt.Errorf("rule %v: unknown action %q", rule.Name, rule.Action)
+		}
+		if rule.When == "" {
+			return fmt.Errorf("rule %v: missing condition", rule.Name)
+		}
+		q, err := query.Parse(rule.When)
+		if err != nil {
+			return fmt.Errorf("rule %v: %v", rule.Name, err)
+		}
+		rule.query = q
+	}
+	return nil
+}
+
+// Evaluate returns the violations of all matching rules. Rules that fail
+// to evaluate are reported in the error, the other rules are still
+// evaluated.
+func (p *Policy) Evaluate(r hashref.Result) ([]hashref.Violation, error) {
+	in := Input(r)
+	var violations []hashref.Violation
+	var errs []string
+	for _, rule := range p.Rules {
+		matched, err := rule.query.Match(in, nil)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("rule %v: %v", rule.Name, err))
+			continue
+		}
+		if matched {
+			violations = append(violations, hashref.Violation{
+				Rule:    rule.Name,
+				Action:  rule.Action,
+				Message: rule.Message,
+			})
+		}
+	}
+	if len(errs) > 0 {
+		return violations, fmt.Errorf("%v", strings.Join(errs, "; "))
+	}
+	return violations, nil
+}
+
+// Input returns the object the rule conditions are evaluated against
+func Input(r hashref.Result) map[string]interface{} {
+	meta := r.Meta
+	if meta == nil {
+		meta = map[string]interface{}{}
+	}
+	conflicts := []string{}
+	if r.Aggregation != nil {
+		conflicts = r.Aggregation.Conflicts
+	}
+	return map[string]interface{}{
+		"input":      r.Input,
+		"type":       r.Type,
+		"hash":       r.Hash,
+		"status":     string(r.Status),
+		"error":      r.Error,
+		"metadata":   meta,
+		"publishers": hashref.PublisherNames(r.Meta),
+		"trusted":    hashref.TrustedPublisherNames(r.Meta),
+		"conflicts":  conflicts,
+	}
+}
+
+// Failed reports if any violation has the fail action
+func Failed(violations []hashref.Violation) bool {
+	for _, v := range violations {
+		if v.Action == ActionFail {
+			return true
+		}
+	}
+	return false
+}
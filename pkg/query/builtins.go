@@ -0,0 +1,447 @@
+package query
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+type builtin func(e *env, in interface{}, args []node) ([]interface{}, error)
+
+var builtins map[string]builtin
+
+func builtinKey(name string, arity int) string {
+	return fmt.Sprintf("%v/%v", name, arity)
+}
+
+func init() {
+	builtins = map[string]builtin{
+		"empty/0":          func(e *env, in interface{}, args []node) ([]interface{}, error) { return nil, nil },
+		"not/0":            simple(func(in interface{}) (interface{}, error) { return !truthy(in), nil }),
+		"length/0":         simple(length),
+		"keys/0":           simple(keys),
+		"values/0":         selectBy(func(v interface{}) bool { return v != nil }),
+		"type/0":           simple(func(in interface{}) (interface{}, error) { return typeName(in), nil }),
+		"tostring/0":       simple(tostring),
+		"tonumber/0":       simple(tonumber),
+		"ascii_downcase/0": stringFunc(strings.ToLower),
+		"ascii_upcase/0":   stringFunc(strings.ToUpper),
+		"to_entries/0":     simple(toEntries),
+		"from_entries/0":   simple(fromEntries),
+		"add/0":            simple(add),
+		"any/0":            simple(func(in interface{}) (interface{}, error) { return anyAll(in, true) }),
+		"all/0":            simple(func(in interface{}) (interface{}, error) { return anyAll(in, false) }),
+		"first/0":          simple(func(in interface{}) (interface{}, error) { return index(in, float64(0)) }),
+		"last/0":           simple(func(in interface{}) (interface{}, error) { return index(in, float64(-1)) }),
+		"sort/0":           simple(sortValues),
+		"unique/0":         simple(unique),
+		"has/1":            withArg(has),
+		"contains/1":       withArg(func(in, arg interface{}) (interface{}, error) { return contains(in, arg), nil }),
+		"startswith/1":     withStringArg(strings.HasPrefix),
+		"endswith/1":       withStringArg(strings.HasSuffix),
+		"test/1":           withArg(test),
+		"join/1":           withArg(join),
+		"split/1":          withArg(split),
+		"select/1":         selectFunc,
+		"map/1":            mapFunc,
+		"map_values/1":     mapValuesFunc,
+		"with_entries/1":   withEntriesFunc,
+		"any/1":            anyAllFunc(true),
+		"all/1":            anyAllFunc(false),
+	}
+}
+
+// simple wraps a function that maps the input to exactly one output
+func simple(fn func(in interface{}) (interface{}, error)) builtin {
+	return func(e *env, in interface{}, args []node) ([]interface{}, error) {
+		v, err := fn(in)
+		if err != nil {
+			return nil, err
+		}
+		return []interface{}{v}, nil
+	}
+}
+
+// withArg wraps a function with one argument that is evaluated against
+// the input, the function is called for every output of the argument
+func withArg(fn func(in, arg interface{}) (interface{}, error)) builtin {
+	return func(e *env, in interface{}, args []node) ([]interface{}, error) {
+		values, err := args[0].eval(e, in)
+		if err != nil {
+			return nil, err
+		}
+		var out []interface{}
+		for _, arg := range values {
+			v, err := fn(in, arg)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, v)
+		}
+		return out, nil
+	}
+}
+
+func stringFunc(fn func(string) string) builtin {
+	return simple(func(in interface{}) (interface{}, error) {
+		s, ok := in.(string)
+		if !ok {
+			return nil, fmt.Errorf("%v cannot be used as string", typeName(in))
+		}
+		return fn(s), nil
+	})
+}
+
+func withStringArg(fn func(s, arg string) bool) builtin {
+	return withArg(func(in, arg interface{}) (interface{}, error) {
+		s, ok1 := in.(string)
+		a, ok2 := arg.(string)
+		if !ok1 || !ok2 {
+			return nil, fmt.Errorf("%v and %v must be strings", typeName(in), typeName(arg))
+		}
+		return fn(s, a), nil
+	})
+}
+
+func selectBy(fn func(v interface{}) bool) builtin {
+	return func(e *env, in interface{}, args []node) ([]interface{}, error) {
+		if fn(in) {
+			return []interface{}{in}, nil
+		}
+		return nil, nil
+	}
+}
+
+func selectFunc(e *env, in interface{}, args []node) ([]interface{}, error) {
+	conds, err := args[0].eval(e, in)
+	if err != nil {
+		return nil, err
+	}
+	var out []interface{}
+	for _, c := range conds {
+		if truthy(c) {
+			out = append(out, in)
+		}
+	}
+	return out, nil
+}
+
+func mapFunc(e *env, in interface{}, args []node) ([]interface{}, error) {
+	values, err := iterate(in)
+	if err != nil {
+		return nil, err
+	}
+	out := []interface{}{}
+	for _, v := range values {
+		mapped, err := args[0].eval(e, v)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, mapped...)
+	}
+	return []interface{}{out}, nil
+}
+
+func mapValuesFunc(e *env, in interface{}, args []node) ([]interface{}, error) {
+	obj, ok := in.(map[string]interface{})
+	if !ok {
+		return mapFunc(e, in, args)
+	}
+	out := make(map[string]interface{}, len(obj))
+	for k, v := range obj {
+		mapped, err := args[0].eval(e, v)
+		if err != nil {
+			return nil, err
+		}
+		if len(mapped) > 0 {
+			out[k] = mapped[0]
+		}
+	}
+	return []interface{}{out}, nil
+}
+
+func withEntriesFunc(e *env, in interface{}, args []node) ([]interface{}, error) {
+	entries, err := toEntries(in)
+	if err != nil {
+		return nil, err
+	}
+	mapped, err := mapFunc(e, entries, args)
+	if err != nil {
+		return nil, err
+	}
+	obj, err := fromEntries(mapped[0])
+	if err != nil {
+		return nil, err
+	}
+	return []interface{}{obj}, nil
+}
+
+func anyAllFunc(isAny bool) builtin {
+	return func(e *env, in interface{}, args []node) ([]interface{}, error) {
+		values, err := iterate(in)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range values {
+			conds, err := args[0].eval(e, v)
+			if err != nil {
+				return nil, err
+			}
+			for _, c := range conds {
+				if truthy(c) == isAny {
+					return []interface{}{isAny}, nil
+				}
+			}
+		}
+		return []interface{}{!isAny}, nil
+	}
+}
+
+func anyAll(in interface{}, isAny bool) (interface{}, error) {
+	values, err := iterate(in)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range values {
+		if truthy(v) == isAny {
+			return isAny, nil
+		}
+	}
+	return !isAny, nil
+}
+
+func length(in interface{}) (interface{}, error) {
+	switch v := in.(type) {
+	case nil:
+		return float64(0), nil
+	case bool:
+		return nil, fmt.Errorf("boolean has no length")
+	case float64:
+		if v < 0 {
+			return -v, nil
+		}
+		return v, nil
+	case string:
+		return float64(utf8.RuneCountInString(v)), nil
+	case []interface{}:
+		return float64(len(v)), nil
+	case map[string]interface{}:
+		return float64(len(v)), nil
+	}
+	return nil, fmt.Errorf("%v has no length", typeName(in))
+}
+
+func keys(in interface{}) (interface{}, error) {
+	switch v := in.(type) {
+	case map[string]interface{}:
+		out := []interface{}{}
+		for _, k := range sortedKeys(v) {
+			out = append(out, k)
+		}
+		return out, nil
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i := range v {
+			out[i] = float64(i)
+		}
+		return out, nil
+	}
+	return nil, fmt.Errorf("%v has no keys", typeName(in))
+}
+
+func has(in, arg interface{}) (interface{}, error) {
+	switch v := in.(type) {
+	case map[string]interface{}:
+		if k, ok := arg.(string); ok {
+			_, found := v[k]
+			return found, nil
+		}
+	case []interface{}:
+		if i, ok := arg.(float64); ok {
+			return i >= 0 && int(i) < len(v), nil
+		}
+	}
+	return nil, fmt.Errorf("cannot check whether %v has a %v key", typeName(in), typeName(arg))
+}
+
+// contains follows jq: substrings for strings, every element of b must
+// be contained in an element of a for arrays and recursive for objects
+func contains(a, b interface{}) bool {
+	switch av := a.(type) {
+	case string:
+		bv, ok := b.(string)
+		return ok && strings.Contains(av, bv)
+	case []interface{}:
+		bv, ok := b.([]interface{})
+		if !ok {
+			return false
+		}
+		for _, be := range bv {
+			found := false
+			for _, ae := range av {
+				if contains(ae, be) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return false
+			}
+		}
+		return true
+	case map[string]interface{}:
+		bv, ok := b.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		for k, be := range bv {
+			ae, found := av[k]
+			if !found || !contains(ae, be) {
+				return false
+			}
+		}
+		return true
+	}
+	return compare(a, b) == 0
+}
+
+func test(in, arg interface{}) (interface{}, error) {
+	s, ok1 := in.(string)
+	pattern, ok2 := arg.(string)
+	if !ok1 || !ok2 {
+		return nil, fmt.Errorf("%v cannot be matched against %v", typeName(in), typeName(arg))
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	return re.MatchString(s), nil
+}
+
+func join(in, arg interface{}) (interface{}, error) {
+	values, ok := in.([]interface{})
+	sep, ok2 := arg.(string)
+	if !ok || !ok2 {
+		return nil, fmt.Errorf("cannot join %v with %v", typeName(in), typeName(arg))
+	}
+	parts := make([]string, len(values))
+	for i, v := range values {
+		if v != nil {
+			s, _ := tostring(v)
+			parts[i] = s.(string)
+		}
+	}
+	return strings.Join(parts, sep), nil
+}
+
+func split(in, arg interface{}) (interface{}, error) {
+	s, ok := in.(string)
+	sep, ok2 := arg.(string)
+	if !ok || !ok2 {
+		return nil, fmt.Errorf("cannot split %v with %v", typeName(in), typeName(arg))
+	}
+	out := []interface{}{}
+	for _, part := range strings.Split(s, sep) {
+		out = append(out, part)
+	}
+	return out, nil
+}
+
+func tostring(in interface{}) (interface{}, error) {
+	switch v := in.(type) {
+	case string:
+		return v, nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	}
+	b, err := json.Marshal(in)
+	return string(b), err
+}
+
+func tonumber(in interface{}) (interface{}, error) {
+	switch v := in.(type) {
+	case float64:
+		return v, nil
+	case string:
+		n, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse %q as number", v)
+		}
+		return n, nil
+	}
+	return nil, fmt.Errorf("%v cannot be parsed as number", typeName(in))
+}
+
+func toEntries(in interface{}) (interface{}, error) {
+	obj, ok := in.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%v has no entries", typeName(in))
+	}
+	out := []interface{}{}
+	for _, k := range sortedKeys(obj) {
+		out = append(out, map[string]interface{}{"key": k, "value": obj[k]})
+	}
+	return out, nil
+}
+
+func fromEntries(in interface{}) (interface{}, error) {
+	entries, ok := in.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("cannot use %v as entries", typeName(in))
+	}
+	out := map[string]interface{}{}
+	for _, entry := range entries {
+		obj, ok := entry.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("cannot use %v as entry", typeName(entry))
+		}
+		key, err := tostring(obj["key"])
+		if err != nil {
+			return nil, err
+		}
+		out[key.(string)] = obj["value"]
+	}
+	return out, nil
+}
+
+func add(in interface{}) (interface{}, error) {
+	values, err := iterate(in)
+	if err != nil {
+		return nil, err
+	}
+	var sum interface{}
+	for _, v := range values {
+		if sum, err = binary("+", sum, v); err != nil {
+			return nil, err
+		}
+	}
+	return sum, nil
+}
+
+func sortValues(in interface{}) (interface{}, error) {
+	values, ok := in.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%v cannot be sorted", typeName(in))
+	}
+	out := append([]interface{}{}, values...)
+	sort.SliceStable(out, func(i, j int) bool { return compare(out[i], out[j]) < 0 })
+	return out, nil
+}
+
+func unique(in interface{}) (interface{}, error) {
+	sorted, err := sortValues(in)
+	if err != nil {
+		return nil, err
+	}
+	out := []interface{}{}
+	for _, v := range sorted.([]interface{}) {
+		if len(out) == 0 || compare(out[len(out)-1], v) != 0 {
+			out = append(out, v)
+		}
+	}
+	return out, nil
+}
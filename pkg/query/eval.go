@@ -0,0 +1,589 @@
+package query
+
+import (
+	"fmt"
+	"sort"
+)
+
+// env holds the variables available during evaluation
+type env struct {
+	vars map[string]interface{}
+}
+
+// node is an element of the parsed query. Evaluation follows the jq
+// model: every node produces zero or more outputs for a single input.
+type node interface {
+	eval(e *env, in interface{}) ([]interface{}, error)
+}
+
+type identityNode struct{}
+
+func (n *identityNode) eval(e *env, in interface{}) ([]interface{}, error) {
+	return []interface{}{in}, nil
+}
+
+type literalNode struct {
+	value interface{}
+}
+
+func (n *literalNode) eval(e *env, in interface{}) ([]interface{}, error) {
+	return []interface{}{n.value}, nil
+}
+
+type variableNode struct {
+	name string
+}
+
+func (n *variableNode) eval(e *env, in interface{}) ([]interface{}, error) {
+	v, ok := e.vars[n.name]
+	if !ok {
+		return nil, fmt.Errorf("$%v is not defined", n.name)
+	}
+	return []interface{}{v}, nil
+}
+
+type pipeNode struct {
+	left, right node
+}
+
+func (n *pipeNode) eval(e *env, in interface{}) ([]interface{}, error) {
+	lefts, err := n.left.eval(e, in)
+	if err != nil {
+		return nil, err
+	}
+	var out []interface{}
+	for _, l := range lefts {
+		rights, err := n.right.eval(e, l)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, rights...)
+	}
+	return out, nil
+}
+
+type commaNode struct {
+	left, right node
+}
+
+func (n *commaNode) eval(e *env, in interface{}) ([]interface{}, error) {
+	lefts, err := n.left.eval(e, in)
+	if err != nil {
+		return nil, err
+	}
+	rights, err := n.right.eval(e, in)
+	if err != nil {
+		return nil, err
+	}
+	return append(lefts, rights...), nil
+}
+
+// altNode returns the truthy outputs of left or, if there are none,
+// the outputs of right
+type altNode struct {
+	left, right node
+}
+
+func (n *altNode) eval(e *env, in interface{}) ([]interface{}, error) {
+	lefts, err := n.left.eval(e, in)
+	var out []interface{}
+	if err == nil {
+		for _, l := range lefts {
+			if truthy(l) {
+				out = append(out, l)
+			}
+		}
+	}
+	if len(out) > 0 {
+		return out, nil
+	}
+	return n.right.eval(e, in)
+}
+
+type logicNode struct {
+	and         bool
+	left, right node
+}
+
+func (n *logicNode) eval(e *env, in interface{}) ([]interface{}, error) {
+	lefts, err := n.left.eval(e, in)
+	if err != nil {
+		return nil, err
+	}
+	var out []interface{}
+	for _, l := range lefts {
+		// Short circuit
+		if n.and && !truthy(l) {
+			out = append(out, false)
+			continue
+		}
+		if !n.and && truthy(l) {
+			out = append(out, true)
+			continue
+		}
+		rights, err := n.right.eval(e, in)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range rights {
+			out = append(out, truthy(r))
+		}
+	}
+	return out, nil
+}
+
+type binaryNode struct {
+	op          string
+	left, right node
+}
+
+func (n *binaryNode) eval(e *env, in interface{}) ([]interface{}, error) {
+	lefts, err := n.left.eval(e, in)
+	if err != nil {
+		return nil, err
+	}
+	rights, err := n.right.eval(e, in)
+	if err != nil {
+		return nil, err
+	}
+	var out []interface{}
+	for _, l := range lefts {
+		for _, r := range rights {
+			v, err := binary(n.op, l, r)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, v)
+		}
+	}
+	return out, nil
+}
+
+type indexNode struct {
+	target, index node
+}
+
+func (n *indexNode) eval(e *env, in interface{}) ([]interface{}, error) {
+	targets, err := n.target.eval(e, in)
+	if err != nil {
+		return nil, err
+	}
+	indices, err := n.index.eval(e, in)
+	if err != nil {
+		return nil, err
+	}
+	var out []interface{}
+	for _, t := range targets {
+		for _, i := range indices {
+			v, err := index(t, i)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, v)
+		}
+	}
+	return out, nil
+}
+
+type iterateNode struct {
+	target node
+}
+
+func (n *iterateNode) eval(e *env, in interface{}) ([]interface{}, error) {
+	targets, err := n.target.eval(e, in)
+	if err != nil {
+		return nil, err
+	}
+	var out []interface{}
+	for _, t := range targets {
+		values, err := iterate(t)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, values...)
+	}
+	return out, nil
+}
+
+// recurseNode returns the input and all values nested in it
+type recurseNode struct{}
+
+func (n *recurseNode) eval(e *env, in interface{}) ([]interface{}, error) {
+	out := []interface{}{in}
+	switch in.(type) {
+	case map[string]interface{}, []interface{}:
+		values, _ := iterate(in)
+		for _, v := range values {
+			nested, _ := n.eval(e, v)
+			out = append(out, nested...)
+		}
+	}
+	return out, nil
+}
+
+// tryNode suppresses errors of its body
+type tryNode struct {
+	body node
+}
+
+func (n *tryNode) eval(e *env, in interface{}) ([]interface{}, error) {
+	out, err := n.body.eval(e, in)
+	if err != nil {
+		return nil, nil
+	}
+	return out, nil
+}
+
+type arrayNode struct {
+	body node
+}
+
+func (n *arrayNode) eval(e *env, in interface{}) ([]interface{}, error) {
+	if n.body == nil {
+		return []interface{}{[]interface{}{}}, nil
+	}
+	values, err := n.body.eval(e, in)
+	if err != nil {
+		return nil, err
+	}
+	if values == nil {
+		values = []interface{}{}
+	}
+	return []interface{}{values}, nil
+}
+
+type objectEntry struct {
+	key, value node
+}
+
+type objectNode struct {
+	entries []objectEntry
+}
+
+// eval builds an object for every combination of key and value outputs
+func (n *objectNode) eval(e *env, in interface{}) ([]interface{}, error) {
+	objects := []map[string]interface{}{{}}
+	for _, entry := range n.entries {
+		keys, err := entry.key.eval(e, in)
+		if err != nil {
+			return nil, err
+		}
+		values, err := entry.value.eval(e, in)
+		if err != nil {
+			return nil, err
+		}
+		var next []map[string]interface{}
+		for _, obj := range objects {
+			for _, k := range keys {
+				key, ok := k.(string)
+				if !ok {
+					return nil, fmt.Errorf("object keys must be strings, got %v", typeName(k))
+				}
+				for _, v := range values {
+					o := make(map[string]interface{}, len(obj)+1)
+					for ek, ev := range obj {
+						o[ek] = ev
+					}
+					o[key] = v
+					next = append(next, o)
+				}
+			}
+		}
+		objects = next
+	}
+	out := make([]interface{}, len(objects))
+	for i, o := range objects {
+		out[i] = o
+	}
+	return out, nil
+}
+
+type ifNode struct {
+	cond, then, otherwise node
+}
+
+func (n *ifNode) eval(e *env, in interface{}) ([]interface{}, error) {
+	conds, err := n.cond.eval(e, in)
+	if err != nil {
+		return nil, err
+	}
+	var out []interface{}
+	for _, c := range conds {
+		branch := n.then
+		if !truthy(c) {
+			branch = n.otherwise
+		}
+		if branch == nil {
+			out = append(out, in)
+			continue
+		}
+		values, err := branch.eval(e, in)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, values...)
+	}
+	return out, nil
+}
+
+type callNode struct {
+	name string
+	args []node
+}
+
+func (n *callNode) eval(e *env, in interface{}) ([]interface{}, error) {
+	return builtins[builtinKey(n.name, len(n.args))](e, in, n.args)
+}
+
+// truthy reports if a value counts as true, only false and null do not
+func truthy(v interface{}) bool {
+	if v == nil {
+		return false
+	}
+	if b, ok := v.(bool); ok {
+		return b
+	}
+	return true
+}
+
+// typeName returns the jq type name of a value
+func typeName(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// index looks up a key of an object or an element of an array
+func index(target, idx interface{}) (interface{}, error) {
+	if target == nil {
+		return nil, nil
+	}
+	switch t := target.(type) {
+	case map[string]interface{}:
+		if k, ok := idx.(string); ok {
+			return t[k], nil
+		}
+	case []interface{}:
+		if f, ok := idx.(float64); ok {
+			i := int(f)
+			if i < 0 {
+				i += len(t)
+			}
+			if i < 0 || i >= len(t) {
+				return nil, nil
+			}
+			return t[i], nil
+		}
+	}
+	return nil, fmt.Errorf("cannot index %v with %v", typeName(target), typeName(idx))
+}
+
+// iterate returns the elements of an array or the values of an object
+// ordered by key
+func iterate(v interface{}) ([]interface{}, error) {
+	switch t := v.(type) {
+	case []interface{}:
+		return t, nil
+	case map[string]interface{}:
+		keys := sortedKeys(t)
+		out := make([]interface{}, len(keys))
+		for i, k := range keys {
+			out[i] = t[k]
+		}
+		return out, nil
+	}
+	return nil, fmt.Errorf("cannot iterate over %v", typeName(v))
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// binary applies a comparison or arithmetic operator
+func binary(op string, l, r interface{}) (interface{}, error) {
+	switch op {
+	case "==":
+		return compare(l, r) == 0, nil
+	case "!=":
+		return compare(l, r) != 0, nil
+	case "<":
+		return compare(l, r) < 0, nil
+	case "<=":
+		return compare(l, r) <= 0, nil
+	case ">":
+		return compare(l, r) > 0, nil
+	case ">=":
+		return compare(l, r) >= 0, nil
+	}
+
+	// null is the neutral element of +
+	if op == "+" {
+		if l == nil {
+			return r, nil
+		}
+		if r == nil {
+			return l, nil
+		}
+	}
+
+	switch lv := l.(type) {
+	case float64:
+		if rv, ok := r.(float64); ok {
+			switch op {
+			case "+":
+				return lv + rv, nil
+			case "-":
+				return lv - rv, nil
+			case "*":
+				return lv * rv, nil
+			case "/":
+				if rv == 0 {
+					return nil, fmt.Errorf("division by zero")
+				}
+				return lv / rv, nil
+			case "%":
+				if int64(rv) == 0 {
+					return nil, fmt.Errorf("division by zero")
+				}
+				return float64(int64(lv) % int64(rv)), nil
+			}
+		}
+	case string:
+		if rv, ok := r.(string); ok && op == "+" {
+			return lv + rv, nil
+		}
+	case []interface{}:
+		if rv, ok := r.([]interface{}); ok {
+			switch op {
+			case "+":
+				return append(append([]interface{}{}, lv...), rv...), nil
+			case "-":
+				out := []interface{}{}
+				for _, x := range lv {
+					keep := true
+					for _, y := range rv {
+						if compare(x, y) == 0 {
+							keep = false
+							break
+						}
+					}
+					if keep {
+						out = append(out, x)
+					}
+				}
+				return out, nil
+			}
+		}
+	case map[string]interface{}:
+		if rv, ok := r.(map[string]interface{}); ok && op == "+" {
+			out := make(map[string]interface{}, len(lv)+len(rv))
+			for k, v := range lv {
+				out[k] = v
+			}
+			for k, v := range rv {
+				out[k] = v
+			}
+			return out, nil
+		}
+	}
+	return nil, fmt.Errorf("%v and %v cannot be combined with %v", typeName(l), typeName(r), op)
+}
+
+// typeOrder defines the jq ordering between values of different types
+func typeOrder(v interface{}) int {
+	switch t := v.(type) {
+	case nil:
+		return 0
+	case bool:
+		if !t {
+			return 1
+		}
+		return 2
+	case float64:
+		return 3
+	case string:
+		return 4
+	case []interface{}:
+		return 5
+	case map[string]interface{}:
+		return 6
+	}
+	return 7
+}
+
+// compare orders two values like jq: null < false < true < numbers <
+// strings < arrays < objects
+func compare(l, r interface{}) int {
+	lo, ro := typeOrder(l), typeOrder(r)
+	if lo != ro {
+		if lo < ro {
+			return -1
+		}
+		return 1
+	}
+	switch lv := l.(type) {
+	case float64:
+		rv := r.(float64)
+		switch {
+		case lv < rv:
+			return -1
+		case lv > rv:
+			return 1
+		}
+		return 0
+	case string:
+		rv := r.(string)
+		switch {
+		case lv < rv:
+			return -1
+		case lv > rv:
+			return 1
+		}
+		return 0
+	case []interface{}:
+		rv := r.([]interface{})
+		for i := 0; i < len(lv) && i < len(rv); i++ {
+			if c := compare(lv[i], rv[i]); c != 0 {
+				return c
+			}
+		}
+		return compare(float64(len(lv)), float64(len(rv)))
+	case map[string]interface{}:
+		rv := r.(map[string]interface{})
+		lk, rk := sortedKeys(lv), sortedKeys(rv)
+		lka, rka := make([]interface{}, len(lk)), make([]interface{}, len(rk))
+		for i, k := range lk {
+			lka[i] = k
+		}
+		for i, k := range rk {
+			rka[i] = k
+		}
+		if c := compare(lka, rka); c != 0 {
+			return c
+		}
+		for _, k := range lk {
+			if c := compare(lv[k], rv[k]); c != 0 {
+				return c
+			}
+		}
+		return 0
+	}
+	return 0
+}
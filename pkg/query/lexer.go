@@ -0,0 +1,162 @@
+package query
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokField
+	tokNumber
+	tokString
+	tokOp
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	num  float64
+	pos  int
+}
+
+// operators ordered by length, so the longest match wins
+var operators = []string{
+	"==", "!=", "<=", ">=", "//", "..",
+	".", "[", "]", "(", ")", "{", "}", "|", ",", ":", ";", "?",
+	"<", ">", "+", "-", "*", "/", "%",
+}
+
+// lex splits the query into tokens
+func lex(src string) ([]token, error) {
+	var tokens []token
+	i := 0
+	for i < len(src) {
+		c, size := utf8.DecodeRuneInString(src[i:])
+		switch {
+		case unicode.IsSpace(c):
+			i += size
+
+		case c == '#':
+			// Comment until end of line
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+
+		case c == '"':
+			end := i + 1
+			for end < len(src) && src[end] != '"' {
+				if src[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(src) {
+				return nil, fmt.Errorf("unterminated string at %v", i)
+			}
+			s, err := strconv.Unquote(src[i : end+1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid string at %v: %v", i, err)
+			}
+			tokens = append(tokens, token{kind: tokString, text: s, pos: i})
+			i = end + 1
+
+		case isDigit(src, i):
+			end := lexNumber(src, i)
+			n, err := strconv.ParseFloat(src[i:end], 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid number %q at %v", src[i:end], i)
+			}
+			tokens = append(tokens, token{kind: tokNumber, num: n, text: src[i:end], pos: i})
+			i = end
+
+		case isIdentStart(c):
+			end := identEnd(src, i+size)
+			tokens = append(tokens, token{kind: tokIdent, text: src[i:end], pos: i})
+			i = end
+
+		case c == '.' && startsIdent(src[i+1:]):
+			end := identEnd(src, i+1)
+			tokens = append(tokens, token{kind: tokField, text: src[i+1 : end], pos: i})
+			i = end
+
+		default:
+			matched := false
+			for _, op := range operators {
+				if strings.HasPrefix(src[i:], op) {
+					tokens = append(tokens, token{kind: tokOp, text: op, pos: i})
+					i += len(op)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, fmt.Errorf("unexpected character %q at %v", c, i)
+			}
+		}
+	}
+	return append(tokens, token{kind: tokEOF, pos: len(src)}), nil
+}
+
+// lexNumber returns the end of the number at start: digits, an optional
+// fraction and an optional exponent with sign, e.g. 1.5e-5
+func lexNumber(src string, start int) int {
+	end := skipDigits(src, start)
+	if end < len(src) && src[end] == '.' {
+		end = skipDigits(src, end+1)
+	}
+	if end < len(src) && (src[end] == 'e' || src[end] == 'E') {
+		exp := end + 1
+		if exp < len(src) && (src[exp] == '+' || src[exp] == '-') {
+			exp++
+		}
+		if isDigit(src, exp) {
+			end = skipDigits(src, exp)
+		}
+	}
+	return end
+}
+
+func skipDigits(src string, i int) int {
+	for isDigit(src, i) {
+		i++
+	}
+	return i
+}
+
+func isDigit(src string, i int) bool {
+	return i < len(src) && src[i] >= '0' && src[i] <= '9'
+}
+
+// identEnd returns the end of the identifier characters from i on
+func identEnd(src string, i int) int {
+	for i < len(src) {
+		c, size := utf8.DecodeRuneInString(src[i:])
+		if !isIdentPart(c) {
+			break
+		}
+		i += size
+	}
+	return i
+}
+
+// startsIdent reports if src starts with the first character of a field
+// name, $ only starts variables
+func startsIdent(src string) bool {
+	c, _ := utf8.DecodeRuneInString(src)
+	return c == '_' || unicode.IsLetter(c)
+}
+
+func isIdentStart(c rune) bool {
+	return c == '_' || c == '$' || unicode.IsLetter(c)
+}
+
+func isIdentPart(c rune) bool {
+	return c == '_' || unicode.IsLetter(c) || unicode.IsDigit(c)
+}
@@ -0,0 +1,444 @@
+package query
+
+import (
+	"fmt"
+	"strings"
+)
+
+// parser is a recursive descent parser for the query language, the
+// precedence from low to high is: |  ,  //  or  and  comparison  + -  * / %
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func parse(src string) (node, error) {
+	tokens, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	n, err := p.parsePipe()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, p.unexpected(t)
+	}
+	return n, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+// isOp reports if the next token is one of the provided operators
+func (p *parser) isOp(ops ...string) bool {
+	t := p.peek()
+	if t.kind != tokOp {
+		return false
+	}
+	for _, op := range ops {
+		if t.text == op {
+			return true
+		}
+	}
+	return false
+}
+
+// isKeyword reports if the next token is the provided keyword
+func (p *parser) isKeyword(kw string) bool {
+	t := p.peek()
+	return t.kind == tokIdent && t.text == kw
+}
+
+func (p *parser) expectOp(op string) error {
+	if !p.isOp(op) {
+		return fmt.Errorf("expected %q, got %v", op, describe(p.peek()))
+	}
+	p.next()
+	return nil
+}
+
+func (p *parser) expectKeyword(kw string) error {
+	if !p.isKeyword(kw) {
+		return fmt.Errorf("expected %q, got %v", kw, describe(p.peek()))
+	}
+	p.next()
+	return nil
+}
+
+func (p *parser) unexpected(t token) error {
+	return fmt.Errorf("unexpected %v", describe(t))
+}
+
+func describe(t token) string {
+	switch t.kind {
+	case tokEOF:
+		return "end of query"
+	case tokString:
+		return fmt.Sprintf("string %q at %v", t.text, t.pos)
+	case tokField:
+		return fmt.Sprintf("%q at %v", "."+t.text, t.pos)
+	}
+	return fmt.Sprintf("%q at %v", t.text, t.pos)
+}
+
+func (p *parser) parsePipe() (node, error) {
+	left, err := p.parseComma()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("|") {
+		p.next()
+		right, err := p.parseComma()
+		if err != nil {
+			return nil, err
+		}
+		left = &pipeNode{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseComma() (node, error) {
+	left, err := p.parseAlt()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp(",") {
+		p.next()
+		right, err := p.parseAlt()
+		if err != nil {
+			return nil, err
+		}
+		left = &commaNode{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAlt() (node, error) {
+	left, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("//") {
+		p.next()
+		right, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		left = &altNode{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.isKeyword("or") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicNode{and: false, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseCompare()
+	if err != nil {
+		return nil, err
+	}
+	for p.isKeyword("and") {
+		p.next()
+		right, err := p.parseCompare()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicNode{and: true, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseCompare() (node, error) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	if p.isOp("==", "!=", "<", "<=", ">", ">=") {
+		op := p.next().text
+		right, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		return &binaryNode{op: op, left: left, right: right}, nil
+	}
+	return left, nil
+}
+
+func (p *parser) parseAdditive() (node, error) {
+	left, err := p.parseMultiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("+", "-") {
+		op := p.next().text
+		right, err := p.parseMultiplicative()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseMultiplicative() (node, error) {
+	left, err := p.parsePostfix()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("*", "/", "%") {
+		op := p.next().text
+		right, err := p.parsePostfix()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+// parsePostfix parses a primary expression followed by any number of
+// field accesses, index/iteration brackets and optional markers
+func (p *parser) parsePostfix() (node, error) {
+	n, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		switch {
+		case t.kind == tokField:
+			p.next()
+			n = &indexNode{target: n, index: &literalNode{value: t.text}}
+		case p.isOp(".") && p.tokens[p.pos+1].kind == tokString:
+			p.next()
+			n = &indexNode{target: n, index: &literalNode{value: p.next().text}}
+		case p.isOp(".") && p.tokens[p.pos+1].kind == tokOp && p.tokens[p.pos+1].text == "[":
+			p.next()
+		case p.isOp("["):
+			p.next()
+			if p.isOp("]") {
+				p.next()
+				n = &iterateNode{target: n}
+				continue
+			}
+			idx, err := p.parsePipe()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expectOp("]"); err != nil {
+				return nil, err
+			}
+			n = &indexNode{target: n, index: idx}
+		case p.isOp("?"):
+			p.next()
+			n = &tryNode{body: n}
+		default:
+			return n, nil
+		}
+	}
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokNumber:
+		return &literalNode{value: t.num}, nil
+
+	case tokString:
+		return &literalNode{value: t.text}, nil
+
+	case tokField:
+		return &indexNode{target: &identityNode{}, index: &literalNode{value: t.text}}, nil
+
+	case tokIdent:
+		return p.parseIdent(t)
+
+	case tokOp:
+		switch t.text {
+		case ".":
+			// ."key" is a quoted field access
+			if p.peek().kind == tokString {
+				return &indexNode{target: &identityNode{}, index: &literalNode{value: p.next().text}}, nil
+			}
+			return &identityNode{}, nil
+
+		case "..":
+			return &recurseNode{}, nil
+
+		case "(":
+			n, err := p.parsePipe()
+			if err != nil {
+				return nil, err
+			}
+			return n, p.expectOp(")")
+
+		case "[":
+			if p.isOp("]") {
+				p.next()
+				return &arrayNode{}, nil
+			}
+			n, err := p.parsePipe()
+			if err != nil {
+				return nil, err
+			}
+			return &arrayNode{body: n}, p.expectOp("]")
+
+		case "{":
+			return p.parseObject()
+
+		case "-":
+			n, err := p.parsePostfix()
+			if err != nil {
+				return nil, err
+			}
+			return &binaryNode{op: "-", left: &literalNode{value: float64(0)}, right: n}, nil
+		}
+	}
+	return nil, p.unexpected(t)
+}
+
+func (p *parser) parseIdent(t token) (node, error) {
+	switch t.text {
+	case "true":
+		return &literalNode{value: true}, nil
+	case "false":
+		return &literalNode{value: false}, nil
+	case "null":
+		return &literalNode{value: nil}, nil
+	case "if":
+		return p.parseIf()
+	}
+
+	// Variables are provided by the caller
+	if t.text[0] == '$' {
+		return &variableNode{name: t.text[1:]}, nil
+	}
+
+	// Function call with optional arguments separated by ;
+	call := &callNode{name: t.text}
+	if p.isOp("(") {
+		p.next()
+		for {
+			arg, err := p.parsePipe()
+			if err != nil {
+				return nil, err
+			}
+			call.args = append(call.args, arg)
+			if !p.isOp(";") {
+				break
+			}
+			p.next()
+		}
+		if err := p.expectOp(")"); err != nil {
+			return nil, err
+		}
+	}
+	if _, ok := builtins[builtinKey(call.name, len(call.args))]; !ok {
+		return nil, fmt.Errorf("unknown function %v/%v at %v", call.name, len(call.args), t.pos)
+	}
+	return call, nil
+}
+
+// parseIf parses if COND then A (elif COND then B)* (else C)? end
+func (p *parser) parseIf() (node, error) {
+	cond, err := p.parsePipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectKeyword("then"); err != nil {
+		return nil, err
+	}
+	then, err := p.parsePipe()
+	if err != nil {
+		return nil, err
+	}
+	n := &ifNode{cond: cond, then: then}
+	switch {
+	case p.isKeyword("elif"):
+		p.next()
+		n.otherwise, err = p.parseIf()
+		return n, err
+	case p.isKeyword("else"):
+		p.next()
+		if n.otherwise, err = p.parsePipe(); err != nil {
+			return nil, err
+		}
+	}
+	return n, p.expectKeyword("end")
+}
+
+// parseObject parses {key: value, "key": value, (expr): value, key}
+func (p *parser) parseObject() (node, error) {
+	obj := &objectNode{}
+	for !p.isOp("}") {
+		var key node
+		t := p.next()
+		var variable node
+		switch {
+		case t.kind == tokIdent && strings.HasPrefix(t.text, "$") && !p.isOp(":"):
+			key = &literalNode{value: t.text[1:]}
+			variable = &variableNode{name: t.text[1:]}
+		case t.kind == tokIdent || t.kind == tokString:
+			key = &literalNode{value: t.text}
+		case t.kind == tokOp && t.text == "(":
+			k, err := p.parsePipe()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expectOp(")"); err != nil {
+				return nil, err
+			}
+			key = k
+		default:
+			return nil, p.unexpected(t)
+		}
+
+		// Shorthand {key} is {key: .key} and {$name} is {name: $name}
+		var value node
+		if variable != nil {
+			value = variable
+		} else if p.isOp(":") {
+			p.next()
+			v, err := p.parseAlt()
+			if err != nil {
+				return nil, err
+			}
+			value = v
+		} else if lit, ok := key.(*literalNode); ok {
+			value = &indexNode{target: &identityNode{}, index: lit}
+		} else {
+			return nil, fmt.Errorf("expected \":\" after computed object key")
+		}
+		obj.entries = append(obj.entries, objectEntry{key: key, value: value})
+
+		if !p.isOp(",") {
+			break
+		}
+		p.next()
+	}
+	return obj, p.expectOp("}")
+}
@@ -0,0 +1,147 @@
+// Package query implements a small jq-like expression language to
+// filter and transform metadata.
+//
+// Supported are paths (.a.b, ."key", .[0], .[]), pipes, the comma
+// operator, literals, array and object construction, comparisons,
+// arithmetic, and/or, the alternative operator //, if-then-else,
+// variables ($name) and a subset of the jq builtins: empty, not,
+// length, keys, values, type, tostring, tonumber, ascii_downcase,
+// ascii_upcase, to_entries, from_entries, with_entries, add, any, all,
+// first, last, sort, unique, has, contains, startswith, endswith, test,
+// join, split, select, map and map_values.
+package query
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// Query is a parsed query expression
+type Query struct {
+	src  string
+	root node
+}
+
+// Parse compiles the provided expression
+func Parse(src string) (*Query, error) {
+	root, err := parse(src)
+	if err != nil {
+		return nil, err
+	}
+	return &Query{src: src, root: root}, nil
+}
+
+// String returns the source of the query
+func (q *Query) String() string {
+	return q.src
+}
+
+// Run evaluates the query against the input and returns all outputs.
+// The input is normalized to JSON types before evaluation, vars are
+// available as $name within the query.
+func (q *Query) Run(input interface{}, vars map[string]interface{}) ([]interface{}, error) {
+	in, err := Normalize(input)
+	if err != nil {
+		return nil, err
+	}
+	normalizedVars := make(map[string]interface{}, len(vars))
+	for k, v := range vars {
+		if normalizedVars[k], err = Normalize(v); err != nil {
+			return nil, err
+		}
+	}
+	return q.root.eval(&env{vars: normalizedVars}, in)
+}
+
+// Match evaluates the query and reports if any output is truthy
+func (q *Query) Match(input interface{}, vars map[string]interface{}) (bool, error) {
+	out, err := q.Run(input, vars)
+	if err != nil {
+		return false, err
+	}
+	for _, v := range out {
+		if truthy(v) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Normalize converts a value into the types produced by encoding/json
+func Normalize(v interface{}) (interface{}, error) {
+	switch v.(type) {
+	case nil, bool, float64, string:
+		return v, nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var out interface{}
+	err = json.Unmarshal(b, &out)
+	return out, err
+}
+
+// Project returns a copy of the metadata that only contains the provided
+// dot separated paths, e.g. publishers.alice.verdict. A * segment matches
+// every key of an object.
+func Project(meta map[string]interface{}, paths []string) map[string]interface{} {
+	out := map[string]interface{}{}
+	for _, path := range paths {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+		project(meta, out, strings.Split(path, "."))
+	}
+	return out
+}
+
+// project copies the value at the path from src into dst
+func project(src, dst map[string]interface{}, segments []string) {
+	keys := []string{segments[0]}
+	if segments[0] == "*" {
+		keys = keys[:0]
+		for k := range src {
+			keys = append(keys, k)
+		}
+	}
+	for _, key := range keys {
+		value, ok := src[key]
+		if !ok {
+			continue
+		}
+		if len(segments) == 1 {
+			dst[key] = value
+			continue
+		}
+		nested, ok := asMap(value)
+		if !ok {
+			continue
+		}
+		child, ok := dst[key].(map[string]interface{})
+		if !ok {
+			child = map[string]interface{}{}
+		}
+		project(nested, child, segments[1:])
+		if len(child) > 0 {
+			dst[key] = child
+		}
+	}
+}
+
+// asMap returns nested objects as map, including map[string]string
+// used for the default metadata
+func asMap(v interface{}) (map[string]interface{}, bool) {
+	switch m := v.(type) {
+	case map[string]interface{}:
+		return m, true
+	case map[string]string:
+		out := make(map[string]interface{}, len(m))
+		for k, v := range m {
+			out[k] = v
+		}
+		return out, true
+	}
+	return nil, false
+}
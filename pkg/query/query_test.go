@@ -0,0 +1,229 @@
+package query
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestLex(t *testing.T) {
+	tests := []struct {
+		src   string
+		kinds []tokenKind
+		texts []string
+	}{
+		{".a.b", []tokenKind{tokField, tokField}, []string{"a", "b"}},
+		{`."key" // "x"`, []tokenKind{tokOp, tokString, tokOp, tokString}, []string{".", "key", "//", "x"}},
+		{".[0] | .[]", []tokenKind{tokOp, tokOp, tokNumber, tokOp, tokOp, tokOp, tokOp, tokOp}, []string{".", "[", "0", "]", "|", ".", "[", "]"}},
+		{"1 <= 2 != 3", []tokenKind{tokNumber, tokOp, tokNumber, tokOp, tokNumber}, []string{"1", "<=", "2", "!=", "3"}},
+		{"$v and not", []tokenKind{tokIdent, tokIdent, tokIdent}, []string{"$v", "and", "not"}},
+		{"1e-5 2.5E+3 3e2 4.", []tokenKind{tokNumber, tokNumber, tokNumber, tokNumber}, []string{"1e-5", "2.5E+3", "3e2", "4."}},
+		{"1-5", []tokenKind{tokNumber, tokOp, tokNumber}, []string{"1", "-", "5"}},
+		{".a? # comment\n.b", []tokenKind{tokField, tokOp, tokField}, []string{"a", "?", "b"}},
+		{"..", []tokenKind{tokOp}, []string{".."}},
+		{".größe.ä_1", []tokenKind{tokField, tokField}, []string{"größe", "ä_1"}},
+		{"$café | ünicode", []tokenKind{tokIdent, tokOp, tokIdent}, []string{"$café", "|", "ünicode"}},
+		{`"äöü ✓" == "日本"`, []tokenKind{tokString, tokOp, tokString}, []string{"äöü ✓", "==", "日本"}},
+		{"1\u00a0+\u00a02", []tokenKind{tokNumber, tokOp, tokNumber}, []string{"1", "+", "2"}},
+	}
+	for _, tt := range tests {
+		tokens, err := lex(tt.src)
+		if err != nil {
+			t.Errorf("lex(%q): %v", tt.src, err)
+			continue
+		}
+		if last := tokens[len(tokens)-1]; last.kind != tokEOF {
+			t.Errorf("lex(%q): last token %v is no EOF", tt.src, last)
+		}
+		var kinds []tokenKind
+		var texts []string
+		for _, tok := range tokens[:len(tokens)-1] {
+			kinds = append(kinds, tok.kind)
+			texts = append(texts, tok.text)
+		}
+		if !reflect.DeepEqual(kinds, tt.kinds) || !reflect.DeepEqual(texts, tt.texts) {
+			t.Errorf("lex(%q) = %v %q, want %v %q", tt.src, kinds, texts, tt.kinds, tt.texts)
+		}
+	}
+}
+
+func TestLexNumbers(t *testing.T) {
+	tests := []struct {
+		src string
+		num float64
+	}{
+		{"0", 0},
+		{"42", 42},
+		{"1.5", 1.5},
+		{"1e-5", 1e-5},
+		{"1E5", 1e5},
+		{"2.5e+3", 2500},
+	}
+	for _, tt := range tests {
+		tokens, err := lex(tt.src)
+		if err != nil {
+			t.Errorf("lex(%q): %v", tt.src, err)
+			continue
+		}
+		if len(tokens) != 2 || tokens[0].kind != tokNumber || tokens[0].num != tt.num {
+			t.Errorf("lex(%q) = %v, want number %v", tt.src, tokens, tt.num)
+		}
+	}
+}
+
+func TestLexErrors(t *testing.T) {
+	for _, src := range []string{`"open`, "@", `"\q"`} {
+		if _, err := lex(src); err == nil {
+			t.Errorf("lex(%q) succeeded, want error", src)
+		}
+	}
+}
+
+const testInput = `{
+	"name": "app",
+	"size": 10,
+	"tags": ["a", "b"],
+	"publishers": {"alice": {"verdict": "good"}, "bob": {"verdict": "bad"}},
+	"empty": null,
+	"flag": false
+}`
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string // JSON array of the outputs
+	}{
+		// Paths
+		{".name", `["app"]`},
+		{`."name"`, `["app"]`},
+		{".tags[1]", `["b"]`},
+		{".tags[]", `["a","b"]`},
+		{".publishers.alice.verdict", `["good"]`},
+		{".missing", `[null]`},
+
+		// Precedence
+		{"1 + 2 * 3", `[7]`},
+		{"(1 + 2) * 3", `[9]`},
+		{"10 - 4 - 3", `[3]`},
+		{"12 / 2 / 3", `[2]`},
+		{"7 % 4 + 1", `[4]`},
+		{"1 + 2 == 3", `[true]`},
+		{"1 < 2 and 3 < 2 or true", `[true]`},
+		{"true or false and false", `[true]`},
+		{".size, .name | length", `[10,3]`},
+		{".empty // 1, 2", `[1,2]`},
+		{"1e-5 < 1", `[true]`},
+		{"2.5e+3", `[2500]`},
+
+		// Alternative operator
+		{".empty // \"default\"", `["default"]`},
+		{".flag // \"default\"", `["default"]`},
+		{".name // \"default\"", `["app"]`},
+		{".missing // .empty // 3", `[3]`},
+		{"(.tags[] | select(. == \"c\")) // \"none\"", `["none"]`},
+
+		// Optional operator
+		{".name.x?", `[]`},
+		{".tags[]?", `["a","b"]`},
+		{".size[]?", `[]`},
+		{"[.[]?]", `[[null,false,"app",{"alice":{"verdict":"good"},"bob":{"verdict":"bad"}},10,["a","b"]]]`},
+
+		// Conditionals
+		{`if .size > 5 then "big" else "small" end`, `["big"]`},
+		{`if .size > 50 then "huge" elif .size > 5 then "big" else "small" end`, `["big"]`},
+		{`if .size > 50 then "huge" elif .size > 20 then "big" else "small" end`, `["small"]`},
+		{`.empty | if . then "set" end`, `[null]`},
+		{`if .tags[] == "a" then 1 else 2 end`, `[1,2]`},
+
+		// Object and array construction
+		{"{name}", `[{"name":"app"}]`},
+		{`{n: .name, "s": .size}`, `[{"n":"app","s":10}]`},
+		{`{(.name): 1}`, `[{"app":1}]`},
+		{"{$v}", `[{"v":"x"}]`},
+		{"{$v, name}", `[{"v":"x","name":"app"}]`},
+		{"{tag: .tags[]}", `[{"tag":"a"},{"tag":"b"}]`},
+		{"[.tags[], .size]", `[["a","b",10]]`},
+		{"[.publishers[].verdict]", `[["good","bad"]]`},
+
+		// Builtins
+		{".publishers | keys", `[["alice","bob"]]`},
+		{"[.tags[] | ascii_upcase] | join(\",\")", `["A,B"]`},
+		{"$v", `["x"]`},
+	}
+	var input interface{}
+	if err := json.Unmarshal([]byte(testInput), &input); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		q, err := Parse(tt.query)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.query, err)
+			continue
+		}
+		out, err := q.Run(input, map[string]interface{}{"v": "x"})
+		if err != nil {
+			t.Errorf("Run(%q): %v", tt.query, err)
+			continue
+		}
+		var want []interface{}
+		if err := json.Unmarshal([]byte(tt.want), &want); err != nil {
+			t.Fatalf("invalid expectation %q: %v", tt.want, err)
+		}
+		if out == nil {
+			out = []interface{}{}
+		}
+		if !reflect.DeepEqual(out, want) {
+			t.Errorf("Run(%q) = %v, want %v", tt.query, out, want)
+		}
+	}
+}
+
+func TestRunUnicode(t *testing.T) {
+	q, err := Parse(`{größe: .größe, "name": (.straße + " ✓")}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := q.Run(map[string]interface{}{"größe": 3, "straße": "hauptstraße"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []interface{}{map[string]interface{}{"größe": 3.0, "name": "hauptstraße ✓"}}
+	if !reflect.DeepEqual(out, want) {
+		t.Errorf("Run() = %v, want %v", out, want)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, src := range []string{
+		"",
+		".a |",
+		"(1",
+		"[1, 2",
+		"{a: }",
+		"if . then 1",
+		"if . then 1 elif . 2 end",
+		"1e",
+		"unknown_function",
+	} {
+		if _, err := Parse(src); err == nil {
+			t.Errorf("Parse(%q) succeeded, want error", src)
+		}
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	for _, src := range []string{
+		".name.x",
+		".size[]",
+		`.name - 1`,
+	} {
+		q, err := Parse(src)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", src, err)
+			continue
+		}
+		if _, err := q.Run(map[string]interface{}{"name": "app", "size": 10}, nil); err == nil {
+			t.Errorf("Run(%q) succeeded, want error", src)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+// Package tokenauth enforces the scopes of access tokens on the server.
+//
+// Requests with a Bearer token are rejected with 401 if the token is
+// unknown or expired and with 403 if the token lacks a scope the request
+// needs, see hashref.RequiredScopes. Requests without token are passed
+// on, they are authenticated by the publisher, e.g. with hmacauth.
+package tokenauth
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/NodyHub/hashref/pkg/hashref"
+)
+
+// Lookup returns the token with the secret token value
+type Lookup func(token string) (hashref.Token, bool)
+
+// tokenContext is the context key of the authorized token
+type tokenContext struct{}
+
+// TokenFrom returns the token that authorized the request
+func TokenFrom(ctx context.Context) (hashref.Token, bool) {
+	token, ok := ctx.Value(tokenContext{}).(hashref.Token)
+	return token, ok
+}
+
+// Middleware checks the scopes of Bearer tokens and passes the token in
+// the request context
+func Middleware(lookup Lookup, next http.Handler) http.Handler {
+	return middleware(lookup, time.Now, next)
+}
+
+func middleware(lookup Lookup, now func() time.Time, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		auth := req.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "Bearer ") {
+			next.ServeHTTP(w, req)
+			return
+		}
+		token, ok := lookup(strings.TrimPrefix(auth, "Bearer "))
+		if !ok || token.Expired(now()) {
+			http.Error(w, "invalid or expired token", http.StatusUnauthorized)
+			return
+		}
+		if scopes := hashref.RequiredScopes(req.Method, req.URL.Path); !token.Allows(scopes...) {
+			http.Error(w, "token lacks scope "+strings.Join(scopes, ", "), http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), tokenContext{}, token)))
+	})
+}
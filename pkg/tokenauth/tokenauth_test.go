@@ -0,0 +1,70 @@
+package tokenauth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/NodyHub/hashref/pkg/hashref"
+)
+
+var now = time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+var tokens = map[string]hashref.Token{
+	"reader":    {ID: "t1", Scopes: []string{hashref.ScopeRead}},
+	"publisher": {ID: "t2", Scopes: []string{hashref.ScopeRead, hashref.ScopePublish}},
+	"admin":     {ID: "t3", Scopes: hashref.Scopes},
+	"expired":   {ID: "t4", Scopes: hashref.Scopes, Expires: "2025-12-31T23:59:59Z"},
+	"valid":     {ID: "t5", Scopes: []string{hashref.ScopeRead}, Expires: "2026-01-01T00:00:01Z"},
+}
+
+func TestMiddleware(t *testing.T) {
+	tests := []struct {
+		auth   string
+		method string
+		path   string
+		want   int
+	}{
+		{"Bearer reader", http.MethodGet, "/api/hash/abc", http.StatusOK},
+		{"Bearer reader", http.MethodHead, "/api/self", http.StatusOK},
+		{"Bearer reader", http.MethodPost, "/api/hash/abc", http.StatusForbidden},
+		{"Bearer reader", http.MethodDelete, "/api/hash/abc", http.StatusForbidden},
+		{"Bearer publisher", http.MethodPost, "/api/hash/abc", http.StatusOK},
+		{"Bearer publisher", http.MethodPost, "/api/self", http.StatusOK},
+		{"Bearer publisher", http.MethodDelete, "/api/hash/abc/publisher/alice", http.StatusForbidden},
+		{"Bearer publisher", http.MethodPost, "/api/tokens", http.StatusForbidden},
+		{"Bearer publisher", http.MethodGet, "/api/tokens", http.StatusForbidden},
+		{"Bearer admin", http.MethodDelete, "/api/hash/abc", http.StatusOK},
+		{"Bearer admin", http.MethodPost, "/api/tokens", http.StatusOK},
+		{"Bearer admin", http.MethodDelete, "/api/tokens/t1", http.StatusOK},
+		{"Bearer expired", http.MethodGet, "/api/hash/abc", http.StatusUnauthorized},
+		{"Bearer valid", http.MethodGet, "/api/hash/abc", http.StatusOK},
+		{"Bearer unknown", http.MethodGet, "/api/hash/abc", http.StatusUnauthorized},
+		{"alice", http.MethodDelete, "/api/hash/abc", http.StatusOK},
+		{"", http.MethodGet, "/api/hash/abc", http.StatusOK},
+	}
+	lookup := func(secret string) (hashref.Token, bool) {
+		token, ok := tokens[secret]
+		return token, ok
+	}
+	for _, tt := range tests {
+		var authorized hashref.Token
+		handler := middleware(lookup, func() time.Time { return now }, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			authorized, _ = TokenFrom(req.Context())
+		}))
+		req := httptest.NewRequest(tt.method, "http://hashref.example"+tt.path, nil)
+		if tt.auth != "" {
+			req.Header.Set("Authorization", tt.auth)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("%v %v %v = %v, want %v", tt.auth, tt.method, tt.path, rec.Code, tt.want)
+		}
+		if secret := strings.TrimPrefix(tt.auth, "Bearer "); rec.Code == http.StatusOK && tokens[secret].ID != authorized.ID {
+			t.Errorf("%v %v %v: token in context %q, want %q", tt.auth, tt.method, tt.path, authorized.ID, tokens[secret].ID)
+		}
+	}
+}
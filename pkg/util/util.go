@@ -82,7 +82,11 @@ func SetValueInStructByJsonKey(item interface{}, fieldName string, value interfa
 		return fmt.Errorf("field %s does not exist within the provided item", fieldName)
 	}
 	fieldVal := v.Field(fieldNum)
-	fieldVal.Set(reflect.ValueOf(value))
+	newVal := reflect.ValueOf(value)
+	if !newVal.IsValid() || !newVal.Type().AssignableTo(fieldVal.Type()) {
+		return fmt.Errorf("cannot assign %T to field %s of type %v", value, fieldName, fieldVal.Type())
+	}
+	fieldVal.Set(newVal)
 	return nil
 }
 
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/NodyHub/hashref/pkg/hashref"
+	"gopkg.in/yaml.v3"
+)
+
+type TokenCmd struct {
+	Create TokenCreateCmd `cmd:"" help:"Create an access token, the token is only shown once"`
+	List   TokenListCmd   `cmd:"" help:"List the access tokens of the publisher"`
+	Revoke TokenRevokeCmd `cmd:"" help:"Revoke an access token"`
+}
+
+type TokenCreateCmd struct {
+	Name    string        `arg:"" help:"Name of the token, e.g. the CI service"`
+	Scope   string        `optional:"" default:"read" help:"Comma separated scopes (read, publish, delete)"`
+	Expires time.Duration `optional:"" help:"Lifetime of the token, e.g. 720h (default: no expiration)"`
+}
+
+type TokenListCmd struct{}
+
+type TokenRevokeCmd struct {
+	ID string `arg:"" name:"id" help:"ID of the token"`
+}
+
+// runToken manages the access tokens of the publisher
+func runToken(hc *hashref.HashrefClient, command string, outFile *os.File) int {
+	switch command {
+	case "create":
+		scopes := strings.Split(CLI.Token.Create.Scope, ",")
+		if err := hashref.ValidateScopes(scopes); err != nil {
+			usageError("%v", err)
+		}
+		token, err := hc.CreateToken(CLI.Token.Create.Name, scopes, CLI.Token.Create.Expires)
+		if err != nil {
+			return tokenError(err)
+		}
+		if CLI.Format != "text" {
+			return writeTokens(outFile, token)
+		}
+		fmt.Fprintf(outFile, "Token %v created :)\n", token.Name)
+		fmt.Fprintf(outFile, "ID: %v\n", token.ID)
+		fmt.Fprintf(outFile, "Scopes: %v\n", strings.Join(token.Scopes, ","))
+		fmt.Fprintf(outFile, "Token: %v\n", token.Token)
+		fmt.Fprintf(outFile, "Store the token now, it is not shown again. Set HASHREF_TOKEN to use it.\n")
+	case "list":
+		tokens, err := hc.ListTokens()
+		if err != nil {
+			return tokenError(err)
+		}
+		if CLI.Format != "text" {
+			return writeTokens(outFile, tokens)
+		}
+		tw := tabwriter.NewWriter(outFile, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tNAME\tSCOPES\tCREATED\tEXPIRES")
+		for _, t := range tokens {
+			fmt.Fprintf(tw, "%v\t%v\t%v\t%v\t%v\n", t.ID, t.Name, strings.Join(t.Scopes, ","), t.Created, t.Expires)
+		}
+		tw.Flush()
+	case "revoke":
+		if err := hc.RevokeToken(CLI.Token.Revoke.ID); err != nil {
+			return tokenError(err)
+		}
+		fmt.Fprintf(outFile, "Token %v revoked :)\n", CLI.Token.Revoke.ID)
+	}
+	return ExitOK
+}
+
+// writeTokens prints tokens as json or yaml
+func writeTokens(outFile *os.File, v interface{}) int {
+	var err error
+	switch CLI.Format {
+	case "json":
+		enc := json.NewEncoder(outFile)
+		enc.SetIndent("", "    ")
+		err = enc.Encode(v)
+	case "yaml":
+		enc := yaml.NewEncoder(outFile)
+		enc.SetIndent(2)
+		err = enc.Encode(v)
+	default:
+		usageError("format %v is not supported for tokens", CLI.Format)
+	}
+	if err != nil {
+		return tokenError(err)
+	}
+	return ExitOK
+}
+
+// tokenError reports the error and returns the matching exit code
+func tokenError(err error) int {
+	fmt.Fprintf(os.Stderr, "hashref: error: %v\n", err)
+	var respErr *hashref.ResponseError
+	if errors.As(err, &respErr) && respErr.Unauthorized() {
+		return ExitAuthError
+	}
+	return ExitServerError
+}